@@ -0,0 +1,264 @@
+package socketio_client
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"time"
+)
+
+var (
+	DisconnectedError = errors.New("disconnected")
+	AckTimeoutError   = errors.New("ack timeout")
+	TooManyAcksError  = errors.New("too many pending acks")
+)
+
+// AckOverflowPolicy tells what happens to an emit expecting an ack when
+// Options.MaxPendingAcks acks are already pending.
+type AckOverflowPolicy int
+
+const (
+	// AckOverflowReject fails the new emit with TooManyAcksError.
+	AckOverflowReject AckOverflowPolicy = iota
+	// AckOverflowDropOldest fails the oldest pending ack with TooManyAcksError to make room.
+	AckOverflowDropOldest
+)
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// ack is a pending acknowledgement, either the callback given to Emit or
+// the reply targets of a blocked EmitWithAck.
+type ack struct {
+	caller  *caller
+	errArg  bool
+	args    []interface{}
+	done    chan error
+	timeout time.Duration
+	timer   *time.Timer // started when the emit is queued
+	sentAt  time.Time
+	once    sync.Once
+
+	// id is the id of the last packet sent with the ack, if any. Once
+	// cancelled, the ack is no longer registered nor sent.
+	id        int
+	sent      bool
+	cancelled bool
+}
+
+func newAckCaller(c *caller) *ack {
+	return &ack{
+		caller: c,
+		errArg: len(c.Args) > 0 && c.Args[0] == errorType,
+	}
+}
+
+func newAckWaiter(reply []interface{}) *ack {
+	if reply == nil {
+		reply = []interface{}{}
+	}
+	return &ack{
+		args: reply,
+		done: make(chan error, 1),
+	}
+}
+
+func (a *ack) GetArgs() []interface{} {
+	if a.caller != nil {
+		args := a.caller.GetArgs()
+		if a.errArg {
+			args = args[1:]
+		}
+		return args
+	}
+	return a.args
+}
+
+// Call delivers the decoded ack arguments, or the error which prevented it.
+// Callbacks without a leading error parameter are not called on errors. Only
+// the first call is delivered.
+func (a *ack) Call(args []interface{}, err error) {
+	a.once.Do(func() {
+		a.stopTimer()
+		if a.caller != nil {
+			if a.errArg && err != nil {
+				a.caller.CallWith(err)
+			} else if a.errArg {
+				a.caller.Call(append([]interface{}{&err}, args...))
+			} else if err == nil {
+				a.caller.Call(args)
+			}
+			return
+		}
+		a.args = args
+		a.done <- err
+	})
+}
+
+func (a *ack) stopTimer() {
+	if a != nil && a.timer != nil {
+		a.timer.Stop()
+	}
+}
+
+// EmitWithAck emits the message and blocks until the server acknowledges it,
+// returning the ack arguments as decoded by encoding/json. It fails when ctx
+// is done, Options.AckTimeout elapses or the connection drops before the ack arrives.
+//
+// The acks are read by the goroutine running the event handlers: called from
+// a handler, it can only fail, when ctx is done, Options.AckTimeout elapses
+// or the client is closed. Use Emit with an ack callback there instead.
+func (client *Client) EmitWithAck(ctx context.Context, message string, args ...interface{}) ([]interface{}, error) {
+	return client.emitWithAck(ctx, emitFlags{}, message, args)
+}
+
+// EmitWithAckInto is like EmitWithAck but decodes the ack arguments into the pointers in reply.
+//
+// For example:
+//
+//	var (
+//	    ok  bool
+//	    msg string
+//	)
+//	err := client.EmitWithAckInto(ctx, []interface{}{&ok, &msg}, "join", "room")
+func (client *Client) EmitWithAckInto(ctx context.Context, reply []interface{}, message string, args ...interface{}) error {
+	return client.waitAck(ctx, emitFlags{}, newAckWaiter(reply), message, args)
+}
+
+func (client *Client) emitWithAck(ctx context.Context, flags emitFlags, message string, args []interface{}) ([]interface{}, error) {
+	a := newAckWaiter(nil)
+	if err := client.waitAck(ctx, flags, a, message, args); err != nil {
+		return nil, err
+	}
+	return a.args, nil
+}
+
+func (client *Client) waitAck(ctx context.Context, flags emitFlags, a *ack, message string, args []interface{}) error {
+	a.timeout = client.ackTimeout(flags)
+	if err := client.queue(flags, message, args, a); err != nil {
+		return err
+	}
+	select {
+	case err := <-a.done:
+		return err
+	case <-ctx.Done():
+		client.cancelAck(a)
+		return ctx.Err()
+	case <-client.root.closing:
+		// an emit buffered while closing would only fail once the handlers
+		// returned, which never happens when called from one.
+		client.cancelAck(a)
+		select {
+		case err := <-a.done:
+			return err
+		default:
+			return DisconnectedError
+		}
+	}
+}
+
+// cancelAck forgets a, whether it is still buffered or already sent.
+func (client *Client) cancelAck(a *ack) {
+	a.stopTimer()
+	if client.unbuffer(a) {
+		return
+	}
+	client.eventsLock.Lock()
+	defer client.eventsLock.Unlock()
+	a.cancelled = true
+	if a.sent && client.ackMap[a.id] == a {
+		client.removeAck(a.id)
+	}
+}
+
+// startAckTimer starts the timeout of a when its emit is queued, so that it
+// also runs while the emit is buffered.
+func (client *Client) startAckTimer(a *ack) {
+	if a == nil || a.timeout <= 0 {
+		return
+	}
+	a.timer = time.AfterFunc(a.timeout, func() { client.expireAck(a) })
+}
+
+// expireAck fails a with AckTimeoutError, whether it is still buffered, being
+// sent or waiting for the server.
+func (client *Client) expireAck(a *ack) {
+	if client.unbuffer(a) {
+		a.Call(nil, AckTimeoutError)
+		return
+	}
+	client.eventsLock.Lock()
+	if a.cancelled || (a.sent && client.ackMap[a.id] != a) {
+		// cancelled, or already answered.
+		client.eventsLock.Unlock()
+		return
+	}
+	// not sent yet, sendAck sees it is cancelled and skips it.
+	a.cancelled = true
+	if a.sent {
+		client.removeAck(a.id)
+	}
+	client.eventsLock.Unlock()
+	a.Call(nil, AckTimeoutError)
+}
+
+func (client *Client) ackTimeout(flags emitFlags) time.Duration {
+	if flags.timeout > 0 {
+		return flags.timeout
+	}
+	return client.opts.AckTimeout
+}
+
+// addAck registers a under id, it must be called with eventsLock held.
+// When the table is full, the ack dropped to make room is returned and must be failed by the caller.
+func (client *Client) addAck(id int, a *ack) (*ack, error) {
+	var dropped *ack
+	if max := client.opts.MaxPendingAcks; max > 0 && len(client.ackMap) >= max {
+		if client.opts.AckOverflow != AckOverflowDropOldest {
+			return nil, TooManyAcksError
+		}
+		oldest := -1
+		for i, p := range client.ackMap {
+			if oldest < 0 || p.sentAt.Before(client.ackMap[oldest].sentAt) {
+				oldest = i
+			}
+		}
+		dropped = client.ackMap[oldest]
+		client.removeAck(oldest)
+	}
+	a.sentAt = time.Now()
+	client.ackMap[id] = a
+	client.opts.metrics().PendingAcks(client.namespace, 1)
+	return dropped, nil
+}
+
+// removeAck unregisters the ack id, it must be called with eventsLock held.
+func (client *Client) removeAck(id int) (*ack, bool) {
+	a, ok := client.ackMap[id]
+	if !ok {
+		return nil, false
+	}
+	delete(client.ackMap, id)
+	client.opts.metrics().PendingAcks(client.namespace, -1)
+	return a, true
+}
+
+func (client *Client) takeAck(id int) (*ack, bool) {
+	client.eventsLock.Lock()
+	defer client.eventsLock.Unlock()
+	return client.removeAck(id)
+}
+
+// failAcks releases every pending ack with err.
+func (client *Client) failAcks(err error) {
+	client.eventsLock.Lock()
+	pending := make([]*ack, 0, len(client.ackMap))
+	for id := range client.ackMap {
+		a, _ := client.removeAck(id)
+		pending = append(pending, a)
+	}
+	client.eventsLock.Unlock()
+	for _, a := range pending {
+		a.Call(nil, err)
+	}
+}
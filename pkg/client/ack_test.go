@@ -0,0 +1,164 @@
+package socketio_client
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEmitWithAck(t *testing.T) {
+	s := startTestServer(t)
+	s.OnPacket = func(sess *testSession, p string) {
+		// 2<id>["msg","hi"] is acked with 3<id>["ack hi"].
+		if i := strings.IndexByte(p, '['); strings.HasPrefix(p, "2") && i > 1 {
+			sess.Emit("3" + p[1:i] + `["ack hi"]`)
+		}
+	}
+	c, err := NewClient(WithAddr(s.URL), WithTransports("websocket"), WithReconnection(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := c.WaitConnect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	res, err := c.EmitWithAck(ctx, "msg", "hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || res[0] != "ack hi" {
+		t.Fatalf("ack = %v", res)
+	}
+}
+
+// An EmitWithAck called from a handler cannot get its ack, Close releases it
+// instead of waiting for the handler forever.
+func TestEmitWithAckFromHandler(t *testing.T) {
+	s := startTestServer(t)
+	c, err := NewClient(WithAddr(s.URL), WithTransports("websocket"), WithReconnection(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	asked := make(chan struct{})
+	ackErr := make(chan error, 1)
+	c.On("ask", func() {
+		close(asked)
+		_, err := c.EmitWithAck(context.Background(), "never acked")
+		ackErr <- err
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := c.WaitConnect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	s.Sessions()[0].Emit(`2["ask"]`)
+	<-asked
+
+	closed := make(chan struct{})
+	go func() {
+		c.Close()
+		close(closed)
+	}()
+	select {
+	case err := <-ackErr:
+		if !errors.Is(err, DisconnectedError) {
+			t.Fatalf("err = %v, want DisconnectedError", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("EmitWithAck still blocked")
+	}
+	select {
+	case <-closed:
+	case <-time.After(3 * time.Second):
+		t.Fatal("Close blocked")
+	}
+}
+
+// The callbacks get zero values for the arguments the server does not send.
+func TestAckCallbackMissingArgs(t *testing.T) {
+	s := startTestServer(t)
+	s.OnPacket = func(sess *testSession, p string) {
+		if ack, ok := ackOf(p, `[]`); ok {
+			sess.Emit(ack)
+		}
+	}
+	c := connectTestClient(t, s)
+	type result struct {
+		err error
+		ok  bool
+		n   *int
+	}
+	got := make(chan result, 1)
+	c.Emit("m", func(err error, ok bool, n *int) { got <- result{err, ok, n} })
+	select {
+	case r := <-got:
+		if r.err != nil || r.ok || r.n != nil {
+			t.Fatalf("callback called with %v, %v, %v", r.err, r.ok, r.n)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("callback not called")
+	}
+}
+
+func TestAckTimeout(t *testing.T) {
+	s := startTestServer(t)
+	c := connectTestClient(t, s, WithAckTimeout(100*time.Millisecond))
+	got := make(chan error, 1)
+	c.Emit("m", func(err error) { got <- err })
+	select {
+	case err := <-got:
+		if err != AckTimeoutError {
+			t.Fatalf("callback called with %v, want AckTimeoutError", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("callback not called")
+	}
+	if _, err := c.EmitWithAck(context.Background(), "m"); err != AckTimeoutError {
+		t.Fatalf("EmitWithAck = %v, want AckTimeoutError", err)
+	}
+	if _, err := c.Timeout(50*time.Millisecond).EmitWithAck(context.Background(), "m"); err != AckTimeoutError {
+		t.Fatalf("Timeout(...).EmitWithAck = %v, want AckTimeoutError", err)
+	}
+}
+
+func TestAckOverflow(t *testing.T) {
+	t.Run("reject", func(t *testing.T) {
+		s := startTestServer(t)
+		c := connectTestClient(t, s, WithMaxPendingAcks(1, AckOverflowReject))
+		first := make(chan error, 1)
+		if err := c.Emit("m", func(err error) { first <- err }); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Emit("m", func(err error) { t.Error("rejected ack called") }); err != TooManyAcksError {
+			t.Fatalf("Emit = %v, want TooManyAcksError", err)
+		}
+		select {
+		case err := <-first:
+			t.Fatalf("pending ack called with %v", err)
+		case <-time.After(50 * time.Millisecond):
+		}
+	})
+	t.Run("drop oldest", func(t *testing.T) {
+		s := startTestServer(t)
+		c := connectTestClient(t, s, WithMaxPendingAcks(1, AckOverflowDropOldest))
+		first := make(chan error, 1)
+		if err := c.Emit("m", func(err error) { first <- err }); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Emit("m", func(err error) {}); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case err := <-first:
+			if err != TooManyAcksError {
+				t.Fatalf("oldest ack called with %v, want TooManyAcksError", err)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("oldest ack not dropped")
+		}
+	})
+}
@@ -0,0 +1,62 @@
+package socketio_client
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// backoff computes the delay between reconnection attempts, doubling it on
+// every attempt and spreading it by a random jitter, like the socket.io js client.
+type backoff struct {
+	min      time.Duration
+	max      time.Duration
+	factor   float64
+	jitter   float64
+	attempts int
+}
+
+func newBackoff(min, max time.Duration, jitter float64) *backoff {
+	if jitter < 0 {
+		jitter = 0
+	}
+	if jitter > 1 {
+		jitter = 1
+	}
+	return &backoff{
+		min:    min,
+		max:    max,
+		factor: 2,
+		jitter: jitter,
+	}
+}
+
+// Duration returns the delay for the next attempt and counts it.
+func (b *backoff) Duration() time.Duration {
+	d := float64(b.min) * math.Pow(b.factor, float64(b.attempts))
+	b.attempts++
+	// the power overflows after enough attempts, the delay stops growing at max.
+	if d > float64(b.max) || math.IsNaN(d) {
+		d = float64(b.max)
+	}
+	if b.jitter > 0 {
+		deviation := rand.Float64() * b.jitter * d
+		if rand.Intn(2) == 0 {
+			d -= deviation
+		} else {
+			d += deviation
+		}
+	}
+	if d > float64(b.max) || d < 0 {
+		d = float64(b.max)
+	}
+	return time.Duration(d)
+}
+
+func (b *backoff) Attempts() int {
+	return b.attempts
+}
+
+func (b *backoff) Reset() {
+	b.attempts = 0
+}
@@ -0,0 +1,37 @@
+package socketio_client
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoffGrows(t *testing.T) {
+	b := newBackoff(100*time.Millisecond, time.Second, 0)
+	want := []time.Duration{100, 200, 400, 800, 1000, 1000}
+	for i, w := range want {
+		if d := b.Duration(); d != w*time.Millisecond {
+			t.Fatalf("attempt %d: got %v, want %v", i, d, w*time.Millisecond)
+		}
+	}
+	if b.Attempts() != len(want) {
+		t.Fatalf("attempts = %d", b.Attempts())
+	}
+	b.Reset()
+	if d := b.Duration(); d != 100*time.Millisecond {
+		t.Fatalf("after reset: got %v", d)
+	}
+}
+
+func TestBackoffStaysBounded(t *testing.T) {
+	min, max := 100*time.Millisecond, 5*time.Second
+	b := newBackoff(min, max, 0.5)
+	for i := 0; i < 3000; i++ {
+		d := b.Duration()
+		if d < 0 || d > max {
+			t.Fatalf("attempt %d: got %v out of [0, %v]", i, d, max)
+		}
+		if i > 100 && d < max/2 {
+			t.Fatalf("attempt %d: got %v, the jitter spreads max by half at most", i, d)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package socketio_client
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	BufferFullError    = errors.New("send buffer full")
+	BufferExpiredError = errors.New("send buffer expired")
+)
+
+// BufferOverflowPolicy tells what happens to an emit when Options.SendBufferSize
+// emits are already waiting for the namespace to be connected.
+type BufferOverflowPolicy int
+
+const (
+	// BufferOverflowReject fails the new emit with BufferFullError.
+	BufferOverflowReject BufferOverflowPolicy = iota
+	// BufferOverflowDropOldest drops the oldest buffered emit to make room, its ack fails with BufferFullError.
+	BufferOverflowDropOldest
+)
+
+// bufferedEmit is an emit waiting for the namespace to be connected, args
+// starts with the message.
+type bufferedEmit struct {
+	args []interface{}
+	ack  *ack
+	at   time.Time
+}
+
+// canSend tells whether the namespace is connected over a connection which is
+// not in the middle of an upgrade.
+func (client *Client) canSend() bool {
+	conn := client.getConn()
+	client.connectLock.Lock()
+	defer client.connectLock.Unlock()
+	return client.connected && conn != nil && conn.getState() == connStateNormal
+}
+
+// failedAck is an ack to fail once sendLock is released, as its callback may emit.
+type failedAck struct {
+	ack *ack
+	err error
+}
+
+type failedAcks []failedAck
+
+func (f *failedAcks) add(a *ack, err error) {
+	if a != nil {
+		*f = append(*f, failedAck{a, err})
+	}
+}
+
+func (f failedAcks) call() {
+	for _, a := range f {
+		a.ack.Call(nil, a.err)
+	}
+}
+
+// queue sends the emit, or buffers it until the namespace is connected. Emits
+// are always sent in order, so it is also buffered while older ones are.
+// Volatile emits are dropped instead of being buffered.
+func (client *Client) queue(flags emitFlags, message string, args []interface{}, a *ack) error {
+	if err := client.Err(); err != nil {
+		return err
+	}
+	if flags.volatile && !client.canSend() {
+		if a != nil {
+			a.Call(nil, DisconnectedError)
+		}
+		return nil
+	}
+	e := bufferedEmit{
+		args: append([]interface{}{message}, args...),
+		ack:  a,
+		at:   time.Now(),
+	}
+	client.startAckTimer(a)
+	failed, err := client.sendOrBuffer(e)
+	failed.call()
+	if err != nil {
+		a.stopTimer()
+		return err
+	}
+	client.fireOutgoing(message, args)
+	return nil
+}
+
+// sendOrBuffer sends e, or buffers it when it cannot be sent now. The acks
+// dropped meanwhile are returned for the caller to fail.
+func (client *Client) sendOrBuffer(e bufferedEmit) (failed failedAcks, err error) {
+	client.sendLock.Lock()
+	defer client.sendLock.Unlock()
+	ready := client.canSend()
+	client.connectLock.Lock()
+	if !ready || len(client.sendBuffer) > 0 {
+		failed, err = client.pushBuffer(e)
+		client.connectLock.Unlock()
+		if err == nil && ready {
+			go client.flush()
+		}
+		return failed, err
+	}
+	client.connectLock.Unlock()
+
+	dropped, err := client.sendEmit(e)
+	failed.add(dropped, TooManyAcksError)
+	if err != nil && !client.canSend() {
+		// the connection dropped, keep the emit for the next one.
+		client.connectLock.Lock()
+		client.sendBuffer = append([]bufferedEmit{e}, client.sendBuffer...)
+		client.connectLock.Unlock()
+		return failed, nil
+	}
+	return failed, err
+}
+
+// pushBuffer appends e to the send buffer, it must be called with connectLock held.
+// The emits older than Options.SendBufferMaxAge are dropped first, then the oldest
+// one when the buffer is full. Their acks are returned for the caller to fail.
+func (client *Client) pushBuffer(e bufferedEmit) (failedAcks, error) {
+	var failed failedAcks
+	if max := client.opts.SendBufferMaxAge; max > 0 {
+		n := 0
+		for n < len(client.sendBuffer) && time.Since(client.sendBuffer[n].at) > max {
+			failed.add(client.sendBuffer[n].ack, BufferExpiredError)
+			n++
+		}
+		client.sendBuffer = client.sendBuffer[n:]
+	}
+	if max := client.opts.SendBufferSize; max > 0 && len(client.sendBuffer) >= max {
+		if client.opts.SendBufferOverflow != BufferOverflowDropOldest {
+			return failed, BufferFullError
+		}
+		failed.add(client.sendBuffer[0].ack, BufferFullError)
+		client.sendBuffer = client.sendBuffer[1:]
+	}
+	client.sendBuffer = append(client.sendBuffer, e)
+	return failed, nil
+}
+
+// flush sends the buffered emits in order while the namespace can send,
+// dropping the ones older than Options.SendBufferMaxAge.
+func (client *Client) flush() {
+	var failed failedAcks
+	// deferred first, so that the acks are failed after sendLock is released.
+	defer func() { failed.call() }()
+	client.sendLock.Lock()
+	defer client.sendLock.Unlock()
+	for {
+		if !client.canSend() {
+			return
+		}
+		client.connectLock.Lock()
+		if len(client.sendBuffer) == 0 {
+			client.connectLock.Unlock()
+			return
+		}
+		e := client.sendBuffer[0]
+		client.sendBuffer = client.sendBuffer[1:]
+		client.connectLock.Unlock()
+
+		if max := client.opts.SendBufferMaxAge; max > 0 && time.Since(e.at) > max {
+			failed.add(e.ack, BufferExpiredError)
+			continue
+		}
+		dropped, err := client.sendEmit(e)
+		failed.add(dropped, TooManyAcksError)
+		if err != nil {
+			if !client.canSend() {
+				client.connectLock.Lock()
+				client.sendBuffer = append([]bufferedEmit{e}, client.sendBuffer...)
+				client.connectLock.Unlock()
+				return
+			}
+			failed.add(e.ack, err)
+		}
+	}
+}
+
+// sendEmit sends e, see sendAck for the ack it may return.
+func (client *Client) sendEmit(e bufferedEmit) (*ack, error) {
+	if e.ack != nil {
+		_, dropped, err := client.sendAck(e.args, e.ack)
+		return dropped, err
+	}
+	return nil, client.send(e.args)
+}
+
+// unbuffer removes the emit expecting a from the send buffer and tells whether it was there.
+func (client *Client) unbuffer(a *ack) bool {
+	client.connectLock.Lock()
+	defer client.connectLock.Unlock()
+	for i, e := range client.sendBuffer {
+		if e.ack == a {
+			client.sendBuffer = append(client.sendBuffer[:i:i], client.sendBuffer[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// failBuffer drops every buffered emit, failing their acks with err.
+func (client *Client) failBuffer(err error) {
+	client.connectLock.Lock()
+	buffer := client.sendBuffer
+	client.sendBuffer = nil
+	client.connectLock.Unlock()
+	for _, e := range buffer {
+		if e.ack != nil {
+			e.ack.Call(nil, err)
+		}
+	}
+}
+
+// flushAll flushes the send buffer of every namespace.
+func (client *Client) flushAll() {
+	for _, nsp := range client.namespaces() {
+		nsp.flush()
+	}
+}
@@ -0,0 +1,197 @@
+package socketio_client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// holdNamespace delays the server's answer to the CONNECT of nsp, so that
+// its emits are buffered, until the returned func is called.
+func holdNamespace(t *testing.T, s *testServer, nsp string) func() {
+	hold := make(chan struct{})
+	var once sync.Once
+	release := func() { once.Do(func() { close(hold) }) }
+	t.Cleanup(release)
+	s.OnConnect = func(_ *testSession, p string) {
+		if p == "0"+nsp || strings.HasPrefix(p, "0"+nsp+",") {
+			<-hold
+		}
+	}
+	return release
+}
+
+// ackErrors returns an ack callback sending its error to the returned channel.
+func ackErrors() (func(err error), chan error) {
+	errs := make(chan error, 1)
+	return func(err error) { errs <- err }, errs
+}
+
+func expectAckError(t *testing.T, errs chan error, want error) {
+	t.Helper()
+	select {
+	case err := <-errs:
+		if !errors.Is(err, want) {
+			t.Fatalf("ack err = %v, want %v", err, want)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("ack not failed with %v", want)
+	}
+}
+
+func TestSendBuffer(t *testing.T) {
+	s := startTestServer(t)
+	packets := receivePackets(s)
+	release := holdNamespace(t, s, "/buf")
+	c := connectTestClient(t, s)
+	nsp := c.Io("/buf")
+	var r recorder
+	nsp.OnAnyOutgoing(func(message string, args []interface{}) { r.add(message) })
+	for _, m := range []string{"a", "b", "c"} {
+		if err := nsp.Emit(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if calls := r.take(); fmt.Sprint(calls) != "[a b c]" {
+		t.Fatalf("outgoing %q, want the buffered emits", calls)
+	}
+	release()
+	for _, m := range []string{"a", "b", "c"} {
+		expectPacket(t, packets, `2/buf,["`+m+`"]`)
+	}
+}
+
+func TestSendBufferOverflow(t *testing.T) {
+	for _, test := range []struct {
+		policy   BufferOverflowPolicy
+		err      error // of the third emit
+		failed   int   // emit whose ack fails with BufferFullError
+		sent     []string
+		outgoing string
+	}{
+		{BufferOverflowReject, BufferFullError, 2, []string{"a", "b"}, "[a b]"},
+		{BufferOverflowDropOldest, nil, 0, []string{"b", "c"}, "[a b c]"},
+	} {
+		t.Run(fmt.Sprint("policy=", test.policy), func(t *testing.T) {
+			s := startTestServer(t)
+			packets := receivePackets(s)
+			release := holdNamespace(t, s, "/buf")
+			c := connectTestClient(t, s, WithSendBuffer(2, 0, test.policy))
+			nsp := c.Io("/buf")
+			var r recorder
+			nsp.OnAnyOutgoing(func(message string, args []interface{}) { r.add(message) })
+			var errs []chan error
+			for i, m := range []string{"a", "b", "c"} {
+				f, ch := ackErrors()
+				errs = append(errs, ch)
+				err := nsp.Emit(m, f)
+				if i == 2 && !errors.Is(err, test.err) {
+					t.Fatalf("third emit err = %v, want %v", err, test.err)
+				}
+			}
+			if test.err == nil {
+				expectAckError(t, errs[test.failed], BufferFullError)
+			}
+			if calls := r.take(); fmt.Sprint(calls) != test.outgoing {
+				t.Fatalf("outgoing %q, want %s", calls, test.outgoing)
+			}
+			release()
+			for i, m := range test.sent {
+				expectPacket(t, packets, fmt.Sprintf(`2/buf,%d["%s"]`, i, m))
+			}
+		})
+	}
+}
+
+func TestSendBufferMaxAge(t *testing.T) {
+	s := startTestServer(t)
+	packets := receivePackets(s)
+	release := holdNamespace(t, s, "/buf")
+	c := connectTestClient(t, s, WithSendBuffer(1, 50*time.Millisecond, BufferOverflowReject))
+	nsp := c.Io("/buf")
+	f, errs := ackErrors()
+	if err := nsp.Emit("old", f); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	// the expired emit no longer takes the room of the new one.
+	if err := nsp.Emit("new"); err != nil {
+		t.Fatalf("emit after the buffered one expired: %v", err)
+	}
+	expectAckError(t, errs, BufferExpiredError)
+	release()
+	expectPacket(t, packets, `2/buf,["new"]`)
+}
+
+func TestVolatileEmit(t *testing.T) {
+	s := startTestServer(t)
+	packets := receivePackets(s)
+	release := holdNamespace(t, s, "/buf")
+	c := connectTestClient(t, s)
+	nsp := c.Io("/buf")
+	var r recorder
+	nsp.OnAnyOutgoing(func(message string, args []interface{}) { r.add(message) })
+	f, errs := ackErrors()
+	if err := nsp.Volatile().Emit("dropped", f); err != nil {
+		t.Fatal(err)
+	}
+	expectAckError(t, errs, DisconnectedError)
+	release()
+	waitConnect(t, nsp)
+	if err := nsp.Volatile().Emit("sent"); err != nil {
+		t.Fatal(err)
+	}
+	expectPacket(t, packets, `2/buf,["sent"]`)
+	if calls := r.take(); fmt.Sprint(calls) != "[sent]" {
+		t.Fatalf("outgoing %q, want only the sent emit", calls)
+	}
+}
+
+// The ack timeout runs from the emit, also while it waits in the send buffer.
+func TestAckTimeoutBuffered(t *testing.T) {
+	s := startTestServer(t)
+	packets := receivePackets(s)
+	release := holdNamespace(t, s, "/buf")
+	c := connectTestClient(t, s, WithAckTimeout(100*time.Millisecond))
+	nsp := c.Io("/buf")
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if _, err := nsp.EmitWithAck(ctx, "buffered"); !errors.Is(err, AckTimeoutError) {
+		t.Fatalf("err = %v, want AckTimeoutError", err)
+	}
+	release()
+	waitConnect(t, nsp)
+	nsp.Emit("after")
+	// the timed out emit was removed from the buffer.
+	expectPacket(t, packets, `2/buf,["after"]`)
+}
+
+// The acks failed to make room are called once the emit is done, their
+// callbacks can emit again.
+func TestFailedAckEmits(t *testing.T) {
+	t.Run("acks", func(t *testing.T) {
+		s := startTestServer(t)
+		packets := receivePackets(s)
+		c := connectTestClient(t, s, WithMaxPendingAcks(1, AckOverflowDropOldest))
+		c.Emit("first", func(err error) { c.Emit("from callback", err.Error()) })
+		c.Emit("second", func() {})
+		expectPacket(t, packets, `2/,0["first"]`)
+		expectPacket(t, packets, `2/,1["second"]`)
+		expectPacket(t, packets, `2/,["from callback","too many pending acks"]`)
+	})
+	t.Run("buffer", func(t *testing.T) {
+		s := startTestServer(t)
+		packets := receivePackets(s)
+		release := holdNamespace(t, s, "/buf")
+		c := connectTestClient(t, s, WithSendBuffer(1, 0, BufferOverflowDropOldest))
+		nsp := c.Io("/buf")
+		nsp.Emit("first", func(err error) { nsp.Emit("from callback", err.Error()) })
+		nsp.Emit("second")
+		release()
+		expectPacket(t, packets, `2/buf,["from callback","send buffer full"]`)
+	})
+}
@@ -1,12 +1,21 @@
 package socketio_client
 
 import (
-	"errors"
 	"fmt"
 	"reflect"
 	"sync"
 )
 
+// handler handles the packets of an event.
+type handler interface {
+	// GetArgs returns the pointers the arguments of the event are decoded into.
+	GetArgs() []interface{}
+	// Handle is called with the decoded arguments and returns the ack reply.
+	Handle(args []interface{}) ([]interface{}, error)
+	// CallWith is called with the arguments of the events raised by the client itself.
+	CallWith(args ...interface{})
+}
+
 type caller struct {
 	sync.RWMutex
 	Func reflect.Value
@@ -53,25 +62,62 @@ func (c *caller) GetArgs() []interface{} {
 func (c *caller) Call(args []interface{}) []reflect.Value {
 	c.RLock()
 	defer c.RUnlock()
-	var a []reflect.Value
-	diff := 0
 
-	a = make([]reflect.Value, len(args))
-	for i, arg := range args {
-		v := reflect.ValueOf(arg)
-		if c.Args[i].Kind() != reflect.Ptr {
-			if v.IsValid() {
-				v = v.Elem()
-			} else {
-				v = reflect.Zero(c.Args[i])
-			}
+	if len(args) > len(c.Args) {
+		// the server sent more arguments than the function takes.
+		args = args[:len(c.Args)]
+	}
+	a := make([]reflect.Value, len(c.Args))
+	for i, argT := range c.Args {
+		if i >= len(args) || args[i] == nil {
+			// the server sent fewer arguments than the function takes.
+			a[i] = reflect.Zero(argT)
+			continue
+		}
+		v := reflect.ValueOf(args[i])
+		if argT.Kind() != reflect.Ptr {
+			v = v.Elem()
 		}
-		a[i+diff] = v
+		a[i] = v
 	}
+	return c.Func.Call(a)
+}
 
-	if len(args) != len(c.Args) {
-		return []reflect.Value{reflect.ValueOf([]interface{}{}), reflect.ValueOf(errors.New("Arguments do not match"))}
+// Handle calls the function and returns its results as the ack reply, apart
+// from a trailing error.
+func (c *caller) Handle(args []interface{}) ([]interface{}, error) {
+	retV := c.Call(args)
+	if len(retV) == 0 {
+		return nil, nil
 	}
 
-	return c.Func.Call(a)
+	var err error
+	if last, ok := retV[len(retV)-1].Interface().(error); ok {
+		err = last
+		retV = retV[0 : len(retV)-1]
+	}
+	ret := make([]interface{}, len(retV))
+	for i, v := range retV {
+		ret[i] = v.Interface()
+	}
+	return ret, err
+}
+
+// CallWith calls the function with plain values, used for the events raised
+// by the client itself. Missing or mismatched arguments are passed as zero values.
+func (c *caller) CallWith(args ...interface{}) {
+	c.RLock()
+	defer c.RUnlock()
+
+	a := make([]reflect.Value, len(c.Args))
+	for i, argT := range c.Args {
+		a[i] = reflect.Zero(argT)
+		if i >= len(args) || args[i] == nil {
+			continue
+		}
+		if v := reflect.ValueOf(args[i]); v.Type().AssignableTo(argT) {
+			a[i] = v
+		}
+	}
+	c.Func.Call(a)
 }
@@ -0,0 +1,47 @@
+package socketio_client
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMaxMessageSize(t *testing.T) {
+	for _, transport := range []string{"polling", "websocket"} {
+		t.Run(transport, func(t *testing.T) {
+			s := startTestServer(t)
+			var mu sync.Mutex
+			var logs []string
+			logger := LoggerFunc(func(level LogLevel, msg string, args ...interface{}) {
+				mu.Lock()
+				defer mu.Unlock()
+				logs = append(logs, fmt.Sprint(msg, args))
+			})
+			c, err := NewClient(WithAddr(s.URL), WithTransports(transport), WithReconnection(false), WithLogger(logger),
+				WithMaxPacketSize(4<<10), WithMaxAttachments(1, 2<<10))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			if err := c.WaitConnect(ctx); err != nil {
+				t.Fatal(err)
+			}
+			s.Sessions()[0].Emit(`2["big","` + strings.Repeat("a", 64<<10) + `"]`)
+			waitFor(t, 2*time.Second, "the disconnection", func() bool {
+				mu.Lock()
+				defer mu.Unlock()
+				for _, l := range logs {
+					if strings.Contains(l, "disconnected") && strings.Contains(l, MessageTooLargeError.Error()) {
+						return true
+					}
+				}
+				return false
+			})
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package socketio_client
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	ClosedError           = errors.New("client closed")
+	ServerDisconnectError = errors.New("server disconnected")
+)
+
+// Close closes the connection for good: the reconnection stops, the engine.io
+// session is closed and Close returns once the goroutines of the client returned.
+// Done is then closed and Err returns ClosedError. As it waits for the event
+// handlers to return, it must not be called from one of them.
+func (client *Client) Close() error {
+	root := client.root
+	root.closeOnce.Do(func() {
+		close(root.closing)
+	})
+	var err error
+	if conn := root.getConn(); conn != nil {
+		err = conn.Close()
+	}
+	root.loops.Wait()
+	if conn := root.getConn(); conn != nil {
+		conn.wait()
+	}
+	root.stop(ClosedError)
+	root.setState(StateClosed)
+	return err
+}
+
+// Done returns a channel closed once the client stopped for good, because it
+// was closed, the server disconnected it or it could not reconnect. Err tells why.
+func (client *Client) Done() <-chan struct{} {
+	return client.root.done
+}
+
+// Err returns why the client stopped: ClosedError, ServerDisconnectError,
+// PingTimeoutError or the error of the transport. It returns nil while the client runs.
+func (client *Client) Err() error {
+	root := client.root
+	root.connLock.RLock()
+	defer root.connLock.RUnlock()
+	return root.err
+}
+
+// closingContext returns a context cancelled once the client is closing.
+func (client *Client) closingContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		select {
+		case <-client.root.closing:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+func (client *Client) isClosing() bool {
+	select {
+	case <-client.root.closing:
+		return true
+	default:
+		return false
+	}
+}
+
+// stop reports the client stopped for err, the emits still buffered fail.
+// Done is closed last, once Err and State tell why.
+func (client *Client) stop(err error) {
+	root := client.root
+	root.connLock.Lock()
+	if root.err != nil {
+		root.connLock.Unlock()
+		return
+	}
+	root.err = err
+	root.connLock.Unlock()
+
+	if err == ClosedError {
+		root.setState(StateClosed)
+	} else {
+		root.setState(StateDisconnected)
+	}
+	for _, nsp := range root.namespaces() {
+		nsp.failBuffer(DisconnectedError)
+	}
+	root.dialer.close()
+	close(root.done)
+}
@@ -0,0 +1,74 @@
+package socketio_client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestClose(t *testing.T) {
+	s := startTestServer(t)
+	c, err := NewClient(WithAddr(s.URL), WithTransports("websocket"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := c.WaitConnect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	select {
+	case <-c.Done():
+	default:
+		t.Fatal("Done is not closed")
+	}
+	if err := c.Err(); !errors.Is(err, ClosedError) {
+		t.Fatalf("Err() = %v, want ClosedError", err)
+	}
+}
+
+// Close aborts a reconnection stuck in the handshake.
+func TestCloseDuringHandshake(t *testing.T) {
+	s := newTestServer(t)
+	var handshakes int32
+	s.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("sid") == "" && atomic.AddInt32(&handshakes, 1) > 1 {
+			// the server hangs once the client reconnects.
+			<-r.Context().Done()
+			return
+		}
+		s.ServeHTTP(w, r)
+	})
+	s.Start()
+	c, err := NewClient(WithAddr(s.URL), WithTransports("polling"), WithReconnectionDelay(10*time.Millisecond, 10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := c.WaitConnect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, sess := range s.Sessions() {
+		sess.close()
+	}
+	waitFor(t, 2*time.Second, "the reconnection", func() bool { return atomic.LoadInt32(&handshakes) > 1 })
+
+	closed := make(chan struct{})
+	go func() {
+		c.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Close blocked by the handshake")
+	}
+	if err := c.Err(); !errors.Is(err, ClosedError) {
+		t.Fatalf("Err() = %v, want ClosedError", err)
+	}
+}
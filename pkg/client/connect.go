@@ -0,0 +1,121 @@
+package socketio_client
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/weblfe/webss/pkg/parser"
+)
+
+// ConnectError is the reason given by the server for refusing to connect a
+// namespace, passed to the OnError callbacks of the namespace.
+type ConnectError struct {
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *ConnectError) Error() string {
+	return "connect error: " + e.Message
+}
+
+// newConnectError reads the payload of an ERROR packet, a plain string with
+// socket.io v2 servers and a {message, data} object since socket.io v3.
+func newConnectError(payload json.RawMessage) *ConnectError {
+	e := &ConnectError{}
+	if err := json.Unmarshal(payload, e); err == nil {
+		return e
+	}
+	if err := json.Unmarshal(payload, &e.Message); err != nil {
+		e.Message = string(payload)
+	}
+	return e
+}
+
+// WithAuth sets the auth payload sent with every CONNECT packet, only with
+// servers speaking EIO=4 (socket.io v3 and later).
+func WithAuth(auth interface{}) Option {
+	return func(options *Options) {
+		options.Auth = func() (interface{}, error) {
+			return auth, nil
+		}
+	}
+}
+
+// WithAuthFunc is like WithAuth but calls f for each CONNECT packet, so that the
+// payload can be refreshed on reconnection.
+func WithAuthFunc(f func() (interface{}, error)) Option {
+	return func(options *Options) {
+		options.Auth = f
+	}
+}
+
+// Id returns the id of the socket in the namespace, the one sent by the server
+// in the CONNECT packet or, for socket.io v2 servers, the one they derive from the engine.io session.
+func (client *Client) Id() string {
+	conn := client.getConn()
+	client.connectLock.Lock()
+	defer client.connectLock.Unlock()
+	if client.sid != "" || !client.connected || conn.Protocol() >= 4 {
+		return client.sid
+	}
+	if client.namespace == "/" {
+		return conn.Id()
+	}
+	return client.namespace + "#" + conn.Id()
+}
+
+func (client *Client) sendConnect() error {
+	conn := client.getConn()
+	packet := parser.Packet{
+		Type: parser.CONNECT,
+		Id:   -1,
+		NSP:  client.namespace,
+	}
+	if conn.Protocol() >= 4 && client.opts.Auth != nil {
+		auth, err := client.opts.Auth()
+		if err != nil {
+			return err
+		}
+		packet.Data = auth
+	}
+	return client.encode(conn, packet)
+}
+
+// connect sends the CONNECT packet of the namespace. A failure is reported
+// like a refusal of the server: WaitConnect returns it and OnError is called.
+func (client *Client) connect() error {
+	err := client.sendConnect()
+	if err != nil {
+		client.opts.logger().Error("connect failed", "namespace", client.namespace, "err", client.opts.redactError(err))
+		client.setConnected("", err)
+		client.callError(err)
+	}
+	return err
+}
+
+func (client *Client) onConnect(decoder *parser.Decoder, packet *parser.Packet) error {
+	var payload json.RawMessage
+	packet.Data = &payload
+	if err := decoder.DecodeData(packet); err != nil {
+		return err
+	}
+	// socket.io v2 servers may send anything, only v3 ones send the id.
+	var info struct {
+		Sid string `json:"sid"`
+	}
+	json.Unmarshal(payload, &info)
+	client.setConnected(info.Sid, nil)
+	return nil
+}
+
+func (client *Client) onError(decoder *parser.Decoder, packet *parser.Packet) error {
+	var payload json.RawMessage
+	packet.Data = &payload
+	if err := decoder.DecodeData(packet); err != nil {
+		return err
+	}
+	err := newConnectError(json.RawMessage(strings.TrimSpace(string(payload))))
+	client.setConnected("", err)
+	client.callError(err)
+	return nil
+}
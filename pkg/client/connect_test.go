@@ -0,0 +1,102 @@
+package socketio_client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// connectPackets records the CONNECT packets received by s.
+func connectPackets(s *testServer) func() []string {
+	var mu sync.Mutex
+	var packets []string
+	s.OnConnect = func(_ *testSession, p string) {
+		mu.Lock()
+		defer mu.Unlock()
+		packets = append(packets, p)
+	}
+	return func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), packets...)
+	}
+}
+
+func TestAuth(t *testing.T) {
+	s := startTestServer(t)
+	packets := connectPackets(s)
+	c := connectTestClient(t, s, WithAuth(map[string]string{"token": "abc"}))
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := c.Io("/chat").WaitConnect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	got := packets()
+	want := []string{`0/,{"token":"abc"}`, `0/chat,{"token":"abc"}`}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("CONNECT packets %q, want %q", got, want)
+	}
+}
+
+// The auth payload is refreshed for every CONNECT packet, the reconnections included.
+func TestAuthFuncReconnect(t *testing.T) {
+	s := startTestServer(t)
+	packets := connectPackets(s)
+	var n int32
+	c, err := NewClient(WithAddr(s.URL), WithTransports("websocket"), WithReconnectionDelay(10*time.Millisecond, 10*time.Millisecond),
+		WithAuthFunc(func() (interface{}, error) {
+			return map[string]int32{"n": atomic.AddInt32(&n, 1)}, nil
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	waitFor(t, 2*time.Second, "connect", func() bool { return len(packets()) == 1 })
+	s.Sessions()[0].close()
+	waitFor(t, 2*time.Second, "reconnect", func() bool { return len(packets()) == 2 })
+	if got := packets(); got[0] != `0/,{"n":1}` || got[1] != `0/,{"n":2}` {
+		t.Fatalf("CONNECT packets %q", got)
+	}
+}
+
+// A failing auth function fails NewClient, which leaves nothing running.
+func TestAuthFuncError(t *testing.T) {
+	s := startTestServer(t)
+	authErr := errors.New("no token")
+	c, err := NewClient(WithAddr(s.URL), WithTransports("websocket"), WithAuthFunc(func() (interface{}, error) {
+		return nil, authErr
+	}))
+	if err != authErr || c != nil {
+		t.Fatalf("NewClient = %v, %v, want nil, %v", c, err, authErr)
+	}
+	sess := s.Sessions()[0]
+	select {
+	case <-sess.closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("the engine.io session is still open")
+	}
+}
+
+// The auth errors of the other namespaces are returned by WaitConnect.
+func TestAuthFuncErrorNamespace(t *testing.T) {
+	s := startTestServer(t)
+	authErr := errors.New("no token")
+	var fail int32
+	c := connectTestClient(t, s, WithAuthFunc(func() (interface{}, error) {
+		if atomic.LoadInt32(&fail) == 1 {
+			return nil, authErr
+		}
+		return nil, nil
+	}))
+	atomic.StoreInt32(&fail, 1)
+	chat := c.Io("/chat")
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := chat.WaitConnect(ctx); err != authErr {
+		t.Fatalf("WaitConnect = %v, want %v", err, authErr)
+	}
+}
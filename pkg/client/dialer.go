@@ -0,0 +1,125 @@
+package socketio_client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/gorilla/websocket"
+)
+
+// dialer sends the HTTP requests of the polling transport and dials the
+// websocket one, it is shared by the successive connections of a client.
+type dialer struct {
+	http      *http.Client
+	websocket *websocket.Dialer
+	owned     *http.Transport // built from the options, released by close
+	decorator func(ctx context.Context, r *http.Request) error
+
+	// websocketWorked tells the last websocket connection succeeded, see Options.RememberUpgrade.
+	websocketWorked int32
+}
+
+// TransportOptionsError tells the proxy, dial function or TLS configuration
+// of the options can not apply to the RoundTripper of HTTPClient or RoundTripper,
+// which is not an *http.Transport.
+var TransportOptionsError = errors.New("proxy, dial and TLS options need an *http.Transport")
+
+// newDialer builds the dialer of the options. Both transports follow the
+// *http.Transport given with HTTPClient or RoundTripper, with the proxy, dial
+// function, TLS configuration and handshake timeout of the options applied
+// on a copy of it. Both share the cookie jar of the options, or else the one
+// of HTTPClient.
+func newDialer(opts *Options) (*dialer, error) {
+	d := &dialer{decorator: opts.RequestDecorator}
+	ws := *websocket.DefaultDialer
+
+	var rt http.RoundTripper
+	own := opts.overridesTransport()
+	switch {
+	case opts.HTTPClient != nil:
+		d.http = opts.HTTPClient
+		rt = opts.HTTPClient.Transport
+		if rt == nil {
+			rt = http.DefaultTransport
+		}
+	case opts.RoundTripper != nil:
+		rt = opts.RoundTripper
+		d.http = &http.Client{Transport: rt}
+	default:
+		rt = http.DefaultTransport
+		d.http = &http.Client{}
+		own = true
+	}
+	if own {
+		t, ok := rt.(*http.Transport)
+		if !ok {
+			return nil, TransportOptionsError
+		}
+		d.owned = t.Clone()
+		if opts.Proxy != nil {
+			d.owned.Proxy = opts.Proxy
+		}
+		if opts.Dial != nil {
+			d.owned.DialContext = opts.Dial
+		}
+		if opts.TLSConfig != nil {
+			d.owned.TLSClientConfig = opts.TLSConfig.Clone()
+		}
+		if opts.HandshakeTimeout > 0 {
+			d.owned.TLSHandshakeTimeout = opts.HandshakeTimeout
+		}
+		c := *d.http
+		c.Transport = d.owned
+		d.http = &c
+		rt = d.owned
+	}
+	if t, ok := rt.(*http.Transport); ok {
+		ws.Proxy = t.Proxy
+		ws.NetDialContext = t.DialContext
+		if t.TLSClientConfig != nil {
+			ws.TLSClientConfig = t.TLSClientConfig.Clone()
+		}
+	}
+	if opts.HandshakeTimeout > 0 {
+		ws.HandshakeTimeout = opts.HandshakeTimeout
+	}
+
+	jar := opts.CookieJar
+	if jar == nil {
+		jar = d.http.Jar
+	} else if d.http.Jar != jar {
+		c := *d.http
+		c.Jar = jar
+		d.http = &c
+	}
+	ws.Jar = jar
+	d.websocket = &ws
+	return d, nil
+}
+
+// overridesTransport tells the options change the settings of the http transport.
+func (opts *Options) overridesTransport() bool {
+	return opts.Proxy != nil || opts.Dial != nil || opts.TLSConfig != nil || opts.HandshakeTimeout > 0
+}
+
+func (d *dialer) upgraded() bool {
+	return atomic.LoadInt32(&d.websocketWorked) != 0
+}
+
+func (d *dialer) setUpgraded(ok bool) {
+	var v int32
+	if ok {
+		v = 1
+	}
+	atomic.StoreInt32(&d.websocketWorked, v)
+}
+
+// close releases the idle connections of the polling transport, unless it
+// was given by the options.
+func (d *dialer) close() {
+	if d.owned != nil {
+		d.owned.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,450 @@
+package socketio_client
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestTLS(t *testing.T) {
+	s := newTestServer(t)
+	s.Upgrades = []string{"websocket"}
+	s.StartTLS()
+	pool := x509.NewCertPool()
+	pool.AddCert(s.Certificate())
+	config := &tls.Config{RootCAs: pool}
+
+	tests := []struct {
+		name string
+		opts []Option
+		fail bool
+	}{
+		{"polling", []Option{WithTransports("polling"), WithTLSConfig(config)}, false},
+		{"websocket", []Option{WithTransports("websocket"), WithTLSConfig(config)}, false},
+		{"upgrade", []Option{WithTLSConfig(config)}, false},
+		{"polling with http client", []Option{WithTransports("polling"), WithHTTPClient(&http.Client{}), WithTLSConfig(config)}, false},
+		{"websocket with http client", []Option{WithTransports("websocket"), WithHTTPClient(&http.Client{}), WithTLSConfig(config)}, false},
+		{"polling with round tripper", []Option{WithTransports("polling"), WithRoundTripper(http.DefaultTransport.(*http.Transport).Clone()), WithTLSConfig(config)}, false},
+		{"polling with http client config", []Option{WithTransports("polling"), WithHTTPClient(s.Client())}, false},
+		{"websocket with http client config", []Option{WithTransports("websocket"), WithHTTPClient(s.Client())}, false},
+		{"unknown ca", []Option{WithTransports("polling", "websocket")}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := append([]Option{WithAddr(s.URL), WithReconnection(false)}, tt.opts...)
+			c, err := NewClient(opts...)
+			if tt.fail {
+				if err == nil {
+					c.Close()
+					t.Fatal("connected without trusting the certificate")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			if err := c.WaitConnect(ctx); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestTransportOptionsNeedHTTPTransport(t *testing.T) {
+	rt := roundTripperFunc(http.DefaultTransport.RoundTrip)
+	_, err := NewClient(WithAddr("https://localhost:1"), WithRoundTripper(rt), WithTLSConfig(&tls.Config{}))
+	if err != TransportOptionsError {
+		t.Fatalf("err = %v, want TransportOptionsError", err)
+	}
+}
+
+// tunnel copies a to b and b to a until either is closed.
+func tunnel(a, b net.Conn) {
+	go func() {
+		io.Copy(a, b)
+		a.Close()
+		b.Close()
+	}()
+	io.Copy(b, a)
+	a.Close()
+	b.Close()
+}
+
+// startConnectProxy starts an HTTP CONNECT proxy, it records the address and
+// the Proxy-Authorization header of every tunnel it opens.
+func startConnectProxy(t *testing.T, r *recorder) *httptest.Server {
+	p := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodConnect {
+			http.Error(w, "CONNECT only", http.StatusMethodNotAllowed)
+			return
+		}
+		r.add(req.Host + " " + req.Header.Get("Proxy-Authorization"))
+		target, err := net.Dial("tcp", req.Host)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			target.Close()
+			return
+		}
+		io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+		tunnel(conn, target)
+	}))
+	t.Cleanup(p.Close)
+	return p
+}
+
+// startSocks5Proxy starts a SOCKS5 proxy without authentication, it records
+// the address of every connection it opens.
+func startSocks5Proxy(t *testing.T, r *recorder) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serveSocks5(conn, r)
+		}
+	}()
+	return l.Addr().String()
+}
+
+func serveSocks5(conn net.Conn, r *recorder) {
+	defer conn.Close()
+	buf := make([]byte, 256)
+	// the methods offered, then the CONNECT request: version, command, reserved and address type.
+	if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+		return
+	}
+	if _, err := io.ReadFull(conn, buf[:buf[1]]); err != nil {
+		return
+	}
+	conn.Write([]byte{5, 0})
+	if _, err := io.ReadFull(conn, buf[:4]); err != nil {
+		return
+	}
+	var host string
+	switch buf[3] {
+	case 1:
+		if _, err := io.ReadFull(conn, buf[:4]); err != nil {
+			return
+		}
+		host = net.IP(buf[:4]).String()
+	case 3:
+		if _, err := io.ReadFull(conn, buf[:1]); err != nil {
+			return
+		}
+		n := buf[0]
+		if _, err := io.ReadFull(conn, buf[:n]); err != nil {
+			return
+		}
+		host = string(buf[:n])
+	default:
+		return
+	}
+	if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+		return
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(int(buf[0])<<8|int(buf[1])))
+	r.add(addr)
+	target, err := net.Dial("tcp", addr)
+	if err != nil {
+		conn.Write([]byte{5, 1, 0, 1, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+	tunnel(conn, target)
+}
+
+// waitTransport waits for the connection of c to run over its last transport,
+// once upgraded.
+func waitTransport(t *testing.T, c *Client, transports []string) {
+	t.Helper()
+	last := transports[len(transports)-1]
+	waitFor(t, 2*time.Second, "transport "+last, func() bool { return c.getConn().Transport() == last })
+}
+
+var transportTests = []struct {
+	name       string
+	transports []string
+	tunnels    int // connections opened at least
+}{
+	{"polling", []string{"polling"}, 1},
+	{"websocket", []string{"websocket"}, 1},
+	{"upgrade", []string{"polling", "websocket"}, 2},
+}
+
+func TestConnectProxy(t *testing.T) {
+	s := newTestServer(t)
+	s.Upgrades = []string{"websocket"}
+	s.StartTLS()
+	pool := x509.NewCertPool()
+	pool.AddCert(s.Certificate())
+	for _, tt := range transportTests {
+		t.Run(tt.name, func(t *testing.T) {
+			var r recorder
+			p := startConnectProxy(t, &r)
+			proxy, _ := url.Parse(p.URL)
+			proxy.User = url.UserPassword("user", "pass")
+			c := connectTestClient(t, s, WithTransports(tt.transports...), WithTLSConfig(&tls.Config{RootCAs: pool}), WithProxyURL(proxy))
+			waitTransport(t, c, tt.transports)
+			calls := r.take()
+			if len(calls) < tt.tunnels {
+				t.Fatalf("tunnels %q, want at least %d", calls, tt.tunnels)
+			}
+			// base64 of user:pass.
+			want := s.Listener.Addr().String() + " Basic dXNlcjpwYXNz"
+			for _, call := range calls {
+				if call != want {
+					t.Fatalf("tunnel %q, want %q", call, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSocks5Proxy(t *testing.T) {
+	s := newTestServer(t)
+	s.Upgrades = []string{"websocket"}
+	s.Start()
+	for _, tt := range transportTests {
+		t.Run(tt.name, func(t *testing.T) {
+			var r recorder
+			proxy := &url.URL{Scheme: "socks5", Host: startSocks5Proxy(t, &r)}
+			c := connectTestClient(t, s, WithTransports(tt.transports...), WithProxyURL(proxy))
+			waitTransport(t, c, tt.transports)
+			calls := r.take()
+			if len(calls) < tt.tunnels {
+				t.Fatalf("connections %q, want at least %d", calls, tt.tunnels)
+			}
+			for _, call := range calls {
+				if call != s.Listener.Addr().String() {
+					t.Fatalf("connection to %q, want the server", call)
+				}
+			}
+		})
+	}
+}
+
+func TestDial(t *testing.T) {
+	s := newTestServer(t)
+	s.Upgrades = []string{"websocket"}
+	s.Start()
+	for _, tt := range transportTests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				dials int32
+				d     net.Dialer
+			)
+			dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+				atomic.AddInt32(&dials, 1)
+				return d.DialContext(ctx, network, addr)
+			}
+			c := connectTestClient(t, s, WithTransports(tt.transports...), WithDial(dial))
+			waitTransport(t, c, tt.transports)
+			if n := atomic.LoadInt32(&dials); n < int32(tt.tunnels) {
+				t.Fatalf("%d dials, want at least %d", n, tt.tunnels)
+			}
+		})
+	}
+}
+
+// Against a server which never answers, the handshakes fail after
+// HandshakeTimeout: the TLS one of polling and the websocket upgrade.
+func TestHandshakeTimeout(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		mu    sync.Mutex
+		conns []net.Conn
+	)
+	t.Cleanup(func() {
+		l.Close()
+		mu.Lock()
+		defer mu.Unlock()
+		for _, conn := range conns {
+			conn.Close()
+		}
+	})
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			conns = append(conns, conn)
+			mu.Unlock()
+		}
+	}()
+
+	for _, tt := range []struct {
+		transport string
+		addr      string
+	}{
+		{"polling", "https://" + l.Addr().String()},
+		{"websocket", "http://" + l.Addr().String()},
+	} {
+		t.Run(tt.transport, func(t *testing.T) {
+			done := make(chan error, 1)
+			go func() {
+				c, err := NewClient(WithAddr(tt.addr), WithTransports(tt.transport), WithReconnection(false), WithHandshakeTimeout(100*time.Millisecond))
+				if c != nil {
+					c.Close()
+				}
+				done <- err
+			}()
+			select {
+			case err := <-done:
+				if err == nil {
+					t.Fatal("connected to a server which never answers")
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("the handshake did not time out")
+			}
+		})
+	}
+}
+
+// The cookies set by the handshake, e.g. the affinity one of a load balancer,
+// are sent again with the polls and the websocket upgrade.
+func TestCookieJar(t *testing.T) {
+	for _, tt := range []struct {
+		transports []string
+		requests   []string // always made, the others may be
+	}{
+		// the CONNECT packet is sent, then its answer polled.
+		{[]string{"polling"}, []string{"poll", "send"}},
+		{[]string{"polling", "websocket"}, []string{"upgrade"}},
+	} {
+		t.Run(fmt.Sprint(tt.transports), func(t *testing.T) {
+			s := newTestServer(t)
+			s.Upgrades = []string{"websocket"}
+			var r recorder
+			s.OnRequest = func(w http.ResponseWriter, req *http.Request) {
+				kind := requestKind(req)
+				if kind == "handshake" {
+					http.SetCookie(w, &http.Cookie{Name: "lb", Value: "node1"})
+					return
+				}
+				value := "none"
+				if cookie, err := req.Cookie("lb"); err == nil {
+					value = cookie.Value
+				}
+				r.add(kind + " " + value)
+			}
+			s.Start()
+			jar, err := cookiejar.New(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c := connectTestClient(t, s, WithTransports(tt.transports...), WithCookieJar(jar))
+			waitTransport(t, c, tt.transports)
+			for _, kind := range tt.requests {
+				if !r.has(kind + " node1") {
+					t.Fatalf("requests %q, want %s with the cookie", r.take(), kind)
+				}
+			}
+			for _, call := range r.take() {
+				if !strings.HasSuffix(call, " node1") {
+					t.Fatalf("request without the cookie: %q", call)
+				}
+			}
+		})
+	}
+}
+
+// The decorator runs on every request: the handshake, the polls, the upgrade
+// and those of a reconnection, which get the token rotated meanwhile.
+func TestRequestDecorator(t *testing.T) {
+	s := newTestServer(t)
+	s.Upgrades = []string{"websocket"}
+	var received recorder
+	s.OnRequest = func(w http.ResponseWriter, req *http.Request) {
+		received.add(requestKind(req) + " " + req.Header.Get("Authorization"))
+	}
+	s.Start()
+
+	var (
+		token     atomic.Value
+		decorated recorder
+	)
+	token.Store("t1")
+	decorate := func(ctx context.Context, req *http.Request) error {
+		decorated.add(requestKind(req))
+		req.Header.Set("Authorization", "Bearer "+token.Load().(string))
+		return nil
+	}
+	transports := []string{"polling", "websocket"}
+	c, err := NewClient(WithAddr(s.URL), WithTransports(transports...), WithReconnectionDelay(10*time.Millisecond, 10*time.Millisecond),
+		WithRequestDecorator(decorate), WithAutoConnect(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	reconnected := make(chan struct{}, 1)
+	c.OnReconnect(func(int) { reconnected <- struct{}{} })
+
+	// check waits for the upgrade, then checks every request decorated was
+	// received with the token. The handshake and the upgrade are always
+	// made, the polls only when the upgrade is not over first.
+	check := func(token string) {
+		t.Helper()
+		waitTransport(t, c, transports)
+		for _, kind := range []string{"handshake", "poll", "send", "upgrade"} {
+			want := kind + " Bearer " + token
+			waitFor(t, 2*time.Second, want, func() bool { return received.count(want) == decorated.count(kind) })
+			if (kind == "handshake" || kind == "upgrade") && decorated.count(kind) != 1 {
+				t.Fatalf("%d %s decorated: %q", decorated.count(kind), kind, decorated.take())
+			}
+		}
+		decorated.take()
+		for _, call := range received.take() {
+			if !strings.HasSuffix(call, " Bearer "+token) {
+				t.Fatalf("request %q, want the token %s", call, token)
+			}
+		}
+	}
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	check("t1")
+
+	token.Store("t2")
+	s.Sessions()[0].close()
+	select {
+	case <-reconnected:
+	case <-time.After(2 * time.Second):
+		t.Fatal("not reconnected")
+	}
+	check("t2")
+}
@@ -0,0 +1,66 @@
+package socketio_client
+
+import (
+	"context"
+	"time"
+)
+
+type emitFlags struct {
+	timeout  time.Duration
+	volatile bool
+}
+
+// Emitter emits messages with settings that only apply to them, it is
+// returned by the Client methods which set these settings.
+type Emitter struct {
+	client *Client
+	flags  emitFlags
+}
+
+// Timeout returns an Emitter whose acks fail with AckTimeoutError when they
+// are not received within timeout, overriding Options.AckTimeout.
+//
+// For example:
+//
+//	client.Timeout(5*time.Second).Emit("hello", "world", func(err error, reply string) {
+//	    if err != nil {
+//	        // the server did not acknowledge the event in time
+//	    }
+//	})
+func (client *Client) Timeout(timeout time.Duration) *Emitter {
+	return &Emitter{client: client, flags: emitFlags{timeout: timeout}}
+}
+
+// Volatile returns an Emitter whose emits are dropped instead of being buffered
+// when the namespace is not connected, their acks fail with DisconnectedError.
+//
+// For example:
+//
+//	client.Volatile().Emit("position", x, y)
+func (client *Client) Volatile() *Emitter {
+	return &Emitter{client: client, flags: emitFlags{volatile: true}}
+}
+
+func (e *Emitter) Timeout(timeout time.Duration) *Emitter {
+	flags := e.flags
+	flags.timeout = timeout
+	return &Emitter{client: e.client, flags: flags}
+}
+
+func (e *Emitter) Volatile() *Emitter {
+	flags := e.flags
+	flags.volatile = true
+	return &Emitter{client: e.client, flags: flags}
+}
+
+func (e *Emitter) Emit(message string, args ...interface{}) error {
+	return e.client.emit(e.flags, message, args)
+}
+
+func (e *Emitter) EmitWithAck(ctx context.Context, message string, args ...interface{}) ([]interface{}, error) {
+	return e.client.emitWithAck(ctx, e.flags, message, args)
+}
+
+func (e *Emitter) EmitWithAckInto(ctx context.Context, reply []interface{}, message string, args ...interface{}) error {
+	return e.client.waitAck(ctx, e.flags, newAckWaiter(reply), message, args)
+}
@@ -0,0 +1,174 @@
+package socketio_client
+
+import (
+	"errors"
+	"io"
+
+	"github.com/gorilla/websocket"
+)
+
+// DisconnectReason tells why a namespace was disconnected.
+type DisconnectReason string
+
+const (
+	// ReasonIoServerDisconnect means the server disconnected the namespace.
+	ReasonIoServerDisconnect DisconnectReason = "io server disconnect"
+	// ReasonIoClientDisconnect means Disconnect or Close was called.
+	ReasonIoClientDisconnect DisconnectReason = "io client disconnect"
+	// ReasonPingTimeout means the server stopped answering the heartbeat.
+	ReasonPingTimeout DisconnectReason = "ping timeout"
+	// ReasonTransportClose means the connection was closed.
+	ReasonTransportClose DisconnectReason = "transport close"
+	// ReasonTransportError means the connection failed.
+	ReasonTransportError DisconnectReason = "transport error"
+)
+
+func (r DisconnectReason) String() string {
+	return string(r)
+}
+
+// lifecycle holds the callbacks of OnConnect, OnDisconnect, OnError,
+// OnStateChange and of the reconnection, they are called apart from the event listeners.
+type lifecycle struct {
+	onConnect     []func()
+	onDisconnect  []func(DisconnectReason)
+	onError       []func(error)
+	onStateChange []func(old, new State)
+
+	// on the root client only, the reconnection is the one of the connection.
+	onReconnectAttempt []func(attempt int)
+	onReconnectError   []func(error)
+	onReconnect        []func(attempt int)
+	onReconnectFailed  []func(attempts int)
+}
+
+// OnConnect adds f to the functions called whenever the namespace is
+// connected, including after a reconnection.
+func (client *Client) OnConnect(f func()) {
+	client.eventsLock.Lock()
+	defer client.eventsLock.Unlock()
+	client.lifecycle.onConnect = append(client.lifecycle.onConnect, f)
+}
+
+// OnDisconnect adds f to the functions called with the reason whenever the
+// namespace is disconnected.
+func (client *Client) OnDisconnect(f func(reason DisconnectReason)) {
+	client.eventsLock.Lock()
+	defer client.eventsLock.Unlock()
+	client.lifecycle.onDisconnect = append(client.lifecycle.onDisconnect, f)
+}
+
+// OnError adds f to the functions called with the errors of the namespace: a
+// *ConnectError when the server refused it, or the error which broke the connection.
+func (client *Client) OnError(f func(err error)) {
+	client.eventsLock.Lock()
+	defer client.eventsLock.Unlock()
+	client.lifecycle.onError = append(client.lifecycle.onError, f)
+}
+
+// OnReconnectAttempt adds f to the functions called with the attempt number
+// before every reconnection attempt. The reconnection is the one of the
+// connection shared by the namespaces.
+func (client *Client) OnReconnectAttempt(f func(attempt int)) {
+	root := client.root
+	root.eventsLock.Lock()
+	defer root.eventsLock.Unlock()
+	root.lifecycle.onReconnectAttempt = append(root.lifecycle.onReconnectAttempt, f)
+}
+
+// OnReconnectError adds f to the functions called with the error of every
+// failed reconnection attempt.
+func (client *Client) OnReconnectError(f func(err error)) {
+	root := client.root
+	root.eventsLock.Lock()
+	defer root.eventsLock.Unlock()
+	root.lifecycle.onReconnectError = append(root.lifecycle.onReconnectError, f)
+}
+
+// OnReconnect adds f to the functions called with the attempt number once
+// the connection is opened again, before the namespaces connect.
+func (client *Client) OnReconnect(f func(attempt int)) {
+	root := client.root
+	root.eventsLock.Lock()
+	defer root.eventsLock.Unlock()
+	root.lifecycle.onReconnect = append(root.lifecycle.onReconnect, f)
+}
+
+// OnReconnectFailed adds f to the functions called with the number of
+// attempts once Options.ReconnectionAttempts ran out.
+func (client *Client) OnReconnectFailed(f func(attempts int)) {
+	root := client.root
+	root.eventsLock.Lock()
+	defer root.eventsLock.Unlock()
+	root.lifecycle.onReconnectFailed = append(root.lifecycle.onReconnectFailed, f)
+}
+
+func (client *Client) getLifecycle() lifecycle {
+	client.eventsLock.RLock()
+	defer client.eventsLock.RUnlock()
+	return client.lifecycle
+}
+
+func (client *Client) callConnect() {
+	for _, f := range client.getLifecycle().onConnect {
+		f()
+	}
+}
+
+func (client *Client) callDisconnect(reason DisconnectReason) {
+	for _, f := range client.getLifecycle().onDisconnect {
+		f(reason)
+	}
+}
+
+func (client *Client) callError(err error) {
+	for _, f := range client.getLifecycle().onError {
+		f(err)
+	}
+}
+
+func (client *Client) callReconnectAttempt(attempt int) {
+	for _, f := range client.getLifecycle().onReconnectAttempt {
+		f(attempt)
+	}
+}
+
+func (client *Client) callReconnectError(err error) {
+	for _, f := range client.getLifecycle().onReconnectError {
+		f(err)
+	}
+}
+
+func (client *Client) callReconnect(attempt int) {
+	for _, f := range client.getLifecycle().onReconnect {
+		f(attempt)
+	}
+}
+
+func (client *Client) callReconnectFailed(attempts int) {
+	for _, f := range client.getLifecycle().onReconnectFailed {
+		f(attempts)
+	}
+}
+
+// disconnectReason tells why the connection read by readLoop ended, err being
+// the error readLoop returned. It also returns the error which broke the connection, if any.
+func (client *Client) disconnectReason(conn *clientConn, err error) (DisconnectReason, error) {
+	if client.isClosing() {
+		return ReasonIoClientDisconnect, nil
+	}
+	if err == nil {
+		return ReasonIoServerDisconnect, nil
+	}
+	if connErr := conn.Err(); connErr != nil {
+		err = connErr
+	}
+	var closeErr *websocket.CloseError
+	switch {
+	case err == PingTimeoutError:
+		return ReasonPingTimeout, err
+	case err == io.EOF, err == io.ErrUnexpectedEOF, errors.As(err, &closeErr):
+		return ReasonTransportClose, nil
+	}
+	return ReasonTransportError, err
+}
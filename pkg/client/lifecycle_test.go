@@ -0,0 +1,190 @@
+package socketio_client
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder records the calls of the callbacks of a test.
+type recorder struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (r *recorder) add(call string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, call)
+}
+
+func (r *recorder) has(call string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, c := range r.calls {
+		if c == call {
+			return true
+		}
+	}
+	return false
+}
+
+// take returns the calls recorded so far and forgets them.
+func (r *recorder) take() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	calls := r.calls
+	r.calls = nil
+	return calls
+}
+
+func (r *recorder) count(call string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for _, c := range r.calls {
+		if c == call {
+			n++
+		}
+	}
+	return n
+}
+
+func TestLifecycleReconnect(t *testing.T) {
+	s := startTestServer(t)
+	c, err := NewClient(WithAddr(s.URL), WithTransports("websocket"), WithReconnectionDelay(10*time.Millisecond, 10*time.Millisecond), WithAutoConnect(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	var r recorder
+	c.OnConnect(func() { r.add("connect") })
+	c.OnDisconnect(func(reason DisconnectReason) { r.add("disconnect " + reason.String()) })
+	c.OnError(func(err error) { r.add("error") })
+	c.OnReconnectAttempt(func(attempt int) { r.add("reconnect_attempt") })
+	c.OnReconnect(func(attempt int) { r.add("reconnect") })
+	for _, name := range []string{"connection", "disconnection", "error", "connect_error", "reconnect", "reconnect_attempt"} {
+		name := name
+		c.On(name, func(s string) { r.add("event " + name + " " + s) })
+	}
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, 2*time.Second, "connect", func() bool { return r.has("connect") })
+
+	// application events named like the lifecycle ones are only events.
+	sess := s.Sessions()[0]
+	for _, name := range []string{"connection", "disconnection", "error", "connect_error", "reconnect", "reconnect_attempt"} {
+		sess.Emit(`2["` + name + `","app"]`)
+		waitFor(t, 2*time.Second, "event "+name, func() bool { return r.has("event " + name + " app") })
+	}
+	if r.count("connect") != 1 || r.has("disconnect io server disconnect") || r.has("error") || r.has("reconnect") {
+		t.Fatalf("events reached the lifecycle callbacks: %v", r.calls)
+	}
+
+	sess.close()
+	waitFor(t, 2*time.Second, "reconnect", func() bool { return r.has("reconnect") && r.count("connect") == 2 })
+	if !r.has("disconnect transport close") || !r.has("reconnect_attempt") {
+		t.Fatalf("calls = %v", r.calls)
+	}
+	for _, call := range r.calls {
+		if call == "event reconnect " || call == "event reconnect_attempt " {
+			t.Fatalf("the reconnection reached the event listeners: %v", r.calls)
+		}
+	}
+}
+
+func TestLifecycleConnectError(t *testing.T) {
+	s := startTestServer(t)
+	s.Refuse = "not authorized"
+	c, err := NewClient(WithAddr(s.URL), WithTransports("websocket"), WithReconnection(false), WithAutoConnect(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	errs := make(chan error, 1)
+	c.OnError(func(err error) { errs <- err })
+	c.On("connect_error", func() { t.Error("connect_error raised as an event") })
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	err = c.WaitConnect(ctx)
+	var connectErr *ConnectError
+	if !errors.As(err, &connectErr) || connectErr.Message != "not authorized" {
+		t.Fatalf("WaitConnect = %v", err)
+	}
+	select {
+	case err := <-errs:
+		if !errors.As(err, &connectErr) {
+			t.Fatalf("OnError got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("OnError not called")
+	}
+}
+
+// Without auto-connect, nothing happens before Connect: the callbacks and the
+// namespaces registered meanwhile see the whole connection.
+func TestConnect(t *testing.T) {
+	s := startTestServer(t)
+	packets := receivePackets(s)
+	c, err := NewClient(WithAddr(s.URL), WithTransports("websocket"), WithReconnection(false), WithAutoConnect(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if n := len(s.Sessions()); n != 0 || c.State() != StateConnecting {
+		t.Fatalf("%d sessions and state %s before Connect", n, c.State())
+	}
+	var r recorder
+	c.OnConnect(func() { r.add("connect /") })
+	chat := c.Io("/chat")
+	chat.OnConnect(func() { r.add("connect /chat") })
+	if err := chat.Emit("buffered"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	waitConnect(t, c)
+	waitConnect(t, chat)
+	expectPacket(t, packets, `2/chat,["buffered"]`)
+	if err := c.Connect(); err != nil {
+		t.Fatalf("second Connect: %v", err)
+	}
+	if n := len(s.Sessions()); n != 1 {
+		t.Fatalf("%d sessions, want 1", n)
+	}
+	waitFor(t, 2*time.Second, "connect", func() bool { return r.has("connect /") && r.has("connect /chat") })
+	if r.count("connect /") != 1 || r.count("connect /chat") != 1 {
+		t.Fatalf("calls = %v", r.take())
+	}
+}
+
+// A main namespace which cannot be connected fails Connect and closes the client.
+func TestConnectAuthError(t *testing.T) {
+	s := startTestServer(t)
+	authErr := errors.New("no token")
+	c, err := NewClient(WithAddr(s.URL), WithTransports("websocket"), WithAutoConnect(false), WithAuthFunc(func() (interface{}, error) {
+		return nil, authErr
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := make(chan error, 1)
+	c.OnError(func(err error) { errs <- err })
+	if err := c.Connect(); err != authErr {
+		t.Fatalf("Connect = %v, want %v", err, authErr)
+	}
+	if err := <-errs; err != authErr {
+		t.Fatalf("OnError got %v", err)
+	}
+	if c.Err() != ClosedError || c.Connect() != ClosedError {
+		t.Fatalf("Err = %v after a failed Connect", c.Err())
+	}
+}
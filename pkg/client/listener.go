@@ -0,0 +1,255 @@
+package socketio_client
+
+import (
+	"encoding/json"
+
+	"github.com/weblfe/webss/pkg/parser"
+)
+
+// ListenerId identifies a registered listener, to remove it later.
+type ListenerId uint64
+
+type eventListener struct {
+	id   ListenerId
+	h    handler
+	once bool
+}
+
+// AddListener adds f to the listeners of message and returns its id for Off.
+// Listeners are called in the order they were added, the ack of the event is
+// the result of the first one returning something.
+func (client *Client) AddListener(message string, f interface{}) (ListenerId, error) {
+	c, err := newCaller(f)
+	if err != nil {
+		return 0, err
+	}
+	return client.addListener(message, c, false), nil
+}
+
+// Once is like AddListener but the listener is removed before its first call.
+func (client *Client) Once(message string, f interface{}) (ListenerId, error) {
+	c, err := newCaller(f)
+	if err != nil {
+		return 0, err
+	}
+	return client.addListener(message, c, true), nil
+}
+
+// Off removes the listeners of message with the given ids.
+func (client *Client) Off(message string, ids ...ListenerId) {
+	client.eventsLock.Lock()
+	defer client.eventsLock.Unlock()
+	var kept []eventListener
+	for _, l := range client.events[message] {
+		if !containsListenerId(ids, l.id) {
+			kept = append(kept, l)
+		}
+	}
+	client.setListeners(message, kept)
+}
+
+// RemoveAllListeners removes every listener of the messages, or of all the messages when none is given.
+func (client *Client) RemoveAllListeners(messages ...string) {
+	client.eventsLock.Lock()
+	defer client.eventsLock.Unlock()
+	if len(messages) == 0 {
+		client.events = make(map[string][]eventListener)
+		return
+	}
+	for _, message := range messages {
+		delete(client.events, message)
+	}
+}
+
+func (client *Client) addListener(message string, h handler, once bool) ListenerId {
+	client.eventsLock.Lock()
+	defer client.eventsLock.Unlock()
+	client.listenerId++
+	listeners := client.events[message]
+	// copy on write, dispatch may be iterating the current slice.
+	added := make([]eventListener, len(listeners), len(listeners)+1)
+	copy(added, listeners)
+	client.events[message] = append(added, eventListener{id: client.listenerId, h: h, once: once})
+	return client.listenerId
+}
+
+// setListeners must be called with eventsLock held.
+func (client *Client) setListeners(message string, listeners []eventListener) {
+	if len(listeners) == 0 {
+		delete(client.events, message)
+		return
+	}
+	client.events[message] = listeners
+}
+
+// getListeners returns the listeners to call for message, removing the ones added with Once.
+func (client *Client) getListeners(message string) []eventListener {
+	client.eventsLock.Lock()
+	defer client.eventsLock.Unlock()
+	listeners := client.events[message]
+	var kept []eventListener
+	for i, l := range listeners {
+		if l.once && kept == nil {
+			kept = append(make([]eventListener, 0, len(listeners)), listeners[:i]...)
+		} else if kept != nil && !l.once {
+			kept = append(kept, l)
+		}
+	}
+	if kept != nil {
+		client.setListeners(message, kept)
+	}
+	return listeners
+}
+
+type anyListener struct {
+	id ListenerId
+	f  func(message string, args []json.RawMessage)
+}
+
+type anyOutgoingListener struct {
+	id ListenerId
+	f  func(message string, args []interface{})
+}
+
+// OnAny registers f to be called with every event received in the namespace,
+// before the handler registered for the event if any. Binary attachments are
+// left as their placeholders in args.
+func (client *Client) OnAny(f func(message string, args []json.RawMessage)) ListenerId {
+	client.eventsLock.Lock()
+	defer client.eventsLock.Unlock()
+	client.listenerId++
+	client.onAny = append(client.onAny, anyListener{id: client.listenerId, f: f})
+	return client.listenerId
+}
+
+// OffAny removes the listeners registered with OnAny, or all of them when no id is given.
+func (client *Client) OffAny(ids ...ListenerId) {
+	client.eventsLock.Lock()
+	defer client.eventsLock.Unlock()
+	if len(ids) == 0 {
+		client.onAny = nil
+		return
+	}
+	var kept []anyListener
+	for _, l := range client.onAny {
+		if !containsListenerId(ids, l.id) {
+			kept = append(kept, l)
+		}
+	}
+	client.onAny = kept
+}
+
+// OnAnyOutgoing registers f to be called with every event emitted in the
+// namespace, without the ack callback.
+func (client *Client) OnAnyOutgoing(f func(message string, args []interface{})) ListenerId {
+	client.eventsLock.Lock()
+	defer client.eventsLock.Unlock()
+	client.listenerId++
+	client.onAnyOut = append(client.onAnyOut, anyOutgoingListener{id: client.listenerId, f: f})
+	return client.listenerId
+}
+
+// OffAnyOutgoing removes the listeners registered with OnAnyOutgoing, or all of them when no id is given.
+func (client *Client) OffAnyOutgoing(ids ...ListenerId) {
+	client.eventsLock.Lock()
+	defer client.eventsLock.Unlock()
+	if len(ids) == 0 {
+		client.onAnyOut = nil
+		return
+	}
+	var kept []anyOutgoingListener
+	for _, l := range client.onAnyOut {
+		if !containsListenerId(ids, l.id) {
+			kept = append(kept, l)
+		}
+	}
+	client.onAnyOut = kept
+}
+
+func containsListenerId(ids []ListenerId, id ListenerId) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (client *Client) getAnyListeners() []anyListener {
+	client.eventsLock.RLock()
+	defer client.eventsLock.RUnlock()
+	return client.onAny
+}
+
+func (client *Client) fireOutgoing(message string, args []interface{}) {
+	client.eventsLock.RLock()
+	listeners := client.onAnyOut
+	client.eventsLock.RUnlock()
+	for _, l := range listeners {
+		l.f(message, args)
+	}
+}
+
+// dispatch handles an event with several listeners or OnAny listeners: the
+// arguments are decoded once as raw JSON, then again for each listener. The
+// ack reply is the one of the first listener returning something.
+func (client *Client) dispatch(message string, listeners []eventListener, anyListeners []anyListener, decoder *parser.Decoder, packet *parser.Packet) ([]interface{}, error) {
+	var (
+		raw    []json.RawMessage
+		binary *parser.Binary
+		err    error
+	)
+	if decoder != nil {
+		raw, binary, err = decoder.DecodeRaw(packet)
+		if err != nil {
+			return nil, err
+		}
+		defer binary.Close()
+	}
+	for _, l := range anyListeners {
+		l.f(message, raw)
+	}
+
+	var (
+		reply    []interface{}
+		replyErr error
+	)
+	for _, l := range listeners {
+		args, err := decodeRawArgs(l.h.GetArgs(), raw, binary)
+		if err != nil {
+			return nil, err
+		}
+		ret, err := l.h.Handle(args)
+		if reply == nil && replyErr == nil {
+			reply, replyErr = ret, err
+		}
+	}
+	return reply, replyErr
+}
+
+// decodeRawArgs decodes raw into the pointers of args, the values the handler
+// does not take are ignored. Like with DecodeData, args is cut to the values sent.
+func decodeRawArgs(args []interface{}, raw []json.RawMessage, binary *parser.Binary) ([]interface{}, error) {
+	if len(raw) < len(args) {
+		args = args[:len(raw)]
+	}
+	for i, r := range raw {
+		if i >= len(args) {
+			break
+		}
+		if string(r) == "null" {
+			// as with DecodeData, the handler gets the zero value.
+			args[i] = nil
+			continue
+		}
+		if err := json.Unmarshal(r, args[i]); err != nil {
+			return nil, err
+		}
+	}
+	if binary != nil {
+		if err := binary.Decode(&args); err != nil {
+			return nil, err
+		}
+	}
+	return args, nil
+}
@@ -0,0 +1,162 @@
+package socketio_client
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// emitAndWait sends the events to c, then a "sync" event whose listener
+// tells the events before it were dispatched.
+func emitAndWait(t *testing.T, s *testServer, c *Client, events ...string) {
+	t.Helper()
+	synced := make(chan struct{})
+	id, _ := c.Once("sync", func() { close(synced) })
+	sess := s.Sessions()[0]
+	for _, e := range events {
+		sess.Emit(e)
+	}
+	sess.Emit(`2["sync"]`)
+	select {
+	case <-synced:
+	case <-time.After(2 * time.Second):
+		c.Off("sync", id)
+		t.Fatal("events not dispatched")
+	}
+}
+
+func TestOnAny(t *testing.T) {
+	s := startTestServer(t)
+	c := connectTestClient(t, s)
+	var r recorder
+	first := c.OnAny(func(message string, args []json.RawMessage) {
+		r.add(fmt.Sprintf("any1 %s %s", message, args))
+	})
+	c.OnAny(func(message string, args []json.RawMessage) {
+		r.add("any2 " + message)
+	})
+	c.On("known", func(s string) { r.add("known " + s) })
+	emitAndWait(t, s, c, `2["unknown",1,{"a":true}]`, `2["known","x"]`)
+	want := []string{
+		`any1 unknown [1 {"a":true}]`, "any2 unknown",
+		`any1 known ["x"]`, "any2 known", "known x",
+		"any1 sync []", "any2 sync",
+	}
+	if calls := r.take(); fmt.Sprint(calls) != fmt.Sprint(want) {
+		t.Fatalf("calls %q, want %q", calls, want)
+	}
+
+	c.OffAny(first)
+	emitAndWait(t, s, c, `2["unknown"]`)
+	if calls := r.take(); fmt.Sprint(calls) != fmt.Sprint([]string{"any2 unknown", "any2 sync"}) {
+		t.Fatalf("calls after OffAny(id) %q", calls)
+	}
+
+	c.OnAny(func(message string, args []json.RawMessage) { r.add("any3 " + message) })
+	c.OffAny()
+	emitAndWait(t, s, c, `2["unknown"]`, `2["known","y"]`)
+	if calls := r.take(); fmt.Sprint(calls) != fmt.Sprint([]string{"known y"}) {
+		t.Fatalf("calls after OffAny() %q", calls)
+	}
+}
+
+func TestOnAnyOutgoing(t *testing.T) {
+	s := startTestServer(t)
+	c := connectTestClient(t, s)
+	var r recorder
+	first := c.OnAnyOutgoing(func(message string, args []interface{}) {
+		r.add(fmt.Sprint("out1 ", message, args))
+	})
+	c.OnAnyOutgoing(func(message string, args []interface{}) { r.add("out2 " + message) })
+	c.Emit("hello", 1, "a", func() {})
+	c.OffAnyOutgoing(first)
+	c.Emit("second")
+	c.OffAnyOutgoing()
+	c.Emit("third")
+	want := []string{"out1 hello[1 a]", "out2 hello", "out2 second"}
+	if calls := r.take(); fmt.Sprint(calls) != fmt.Sprint(want) {
+		t.Fatalf("calls %q, want %q", calls, want)
+	}
+}
+
+func TestListenerArgs(t *testing.T) {
+	for _, dispatch := range []bool{false, true} {
+		t.Run(fmt.Sprint("dispatch=", dispatch), func(t *testing.T) {
+			s := startTestServer(t)
+			c := connectTestClient(t, s)
+			var r recorder
+			c.On("args", func(s string, j *testJoin, n int) {
+				r.add(fmt.Sprintf("%q %v %d", s, j, n))
+			})
+			if dispatch {
+				c.On("args", func() {})
+			}
+			emitAndWait(t, s, c,
+				`2["args"]`,
+				`2["args","a"]`,
+				`2["args","a",null,1]`,
+				`2["args","a",{"room":"r"},2,"extra",{}]`,
+			)
+			want := []string{`"" <nil> 0`, `"a" <nil> 0`, `"a" <nil> 1`, `"a" &{r} 2`}
+			if calls := r.take(); fmt.Sprint(calls) != fmt.Sprint(want) {
+				t.Fatalf("calls %q, want %q", calls, want)
+			}
+		})
+	}
+}
+
+func TestListenerOrder(t *testing.T) {
+	s := startTestServer(t)
+	c := connectTestClient(t, s)
+	var r recorder
+	for i := 1; i <= 3; i++ {
+		i := i
+		c.On("order", func() { r.add(fmt.Sprint("on", i)) })
+		c.Once("order", func() { r.add(fmt.Sprint("once", i)) })
+	}
+	emitAndWait(t, s, c, `2["order"]`, `2["order"]`)
+	want := []string{"on1", "once1", "on2", "once2", "on3", "once3", "on1", "on2", "on3"}
+	if calls := r.take(); fmt.Sprint(calls) != fmt.Sprint(want) {
+		t.Fatalf("calls %q, want %q", calls, want)
+	}
+}
+
+func TestOnceRemovedBeforeCall(t *testing.T) {
+	s := startTestServer(t)
+	c := connectTestClient(t, s)
+	var r recorder
+	c.Once("once", func(n int) {
+		c.eventsLock.RLock()
+		left := len(c.events["once"])
+		c.eventsLock.RUnlock()
+		r.add(fmt.Sprint("once ", n, " listeners ", left))
+		// registered again from its own call, it is only called by the next event.
+		c.Once("once", func(n int) { r.add(fmt.Sprint("again ", n)) })
+	})
+	emitAndWait(t, s, c, `2["once",1]`, `2["once",2]`, `2["once",3]`)
+	want := []string{"once 1 listeners 0", "again 2"}
+	if calls := r.take(); fmt.Sprint(calls) != fmt.Sprint(want) {
+		t.Fatalf("calls %q, want %q", calls, want)
+	}
+}
+
+func TestOffDuringDispatch(t *testing.T) {
+	s := startTestServer(t)
+	c := connectTestClient(t, s)
+	var (
+		r      recorder
+		second ListenerId
+	)
+	c.AddListener("off", func(n int) {
+		r.add(fmt.Sprint("first ", n))
+		c.Off("off", second)
+	})
+	second, _ = c.AddListener("off", func(n int) { r.add(fmt.Sprint("second ", n)) })
+	// the listeners of an event are the ones registered when it was received.
+	emitAndWait(t, s, c, `2["off",1]`, `2["off",2]`)
+	want := []string{"first 1", "second 1", "first 2"}
+	if calls := r.take(); fmt.Sprint(calls) != fmt.Sprint(want) {
+		t.Fatalf("calls %q, want %q", calls, want)
+	}
+}
@@ -0,0 +1,155 @@
+package socketio_client
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Logger receives the logs of the client, args are alternating keys and
+// values. A *slog.Logger satisfies it.
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+type LogLevel int
+
+const (
+	LogDebug LogLevel = iota
+	LogInfo
+	LogWarn
+	LogError
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case LogDebug:
+		return "DEBUG"
+	case LogInfo:
+		return "INFO"
+	case LogWarn:
+		return "WARN"
+	case LogError:
+		return "ERROR"
+	}
+	return fmt.Sprintf("LEVEL(%d)", int(l))
+}
+
+// LoggerFunc adapts a function to Logger, for the key/value loggers which
+// take the level as an argument.
+type LoggerFunc func(level LogLevel, msg string, args ...interface{})
+
+func (f LoggerFunc) Debug(msg string, args ...interface{}) { f(LogDebug, msg, args...) }
+func (f LoggerFunc) Info(msg string, args ...interface{})  { f(LogInfo, msg, args...) }
+func (f LoggerFunc) Warn(msg string, args ...interface{})  { f(LogWarn, msg, args...) }
+func (f LoggerFunc) Error(msg string, args ...interface{}) { f(LogError, msg, args...) }
+
+// NewStdLogger returns a Logger printing the logs of at least level to l, or
+// to the standard logger when l is nil, as "LEVEL msg key=value...".
+func NewStdLogger(l *log.Logger, level LogLevel) Logger {
+	if l == nil {
+		l = log.Default()
+	}
+	return LoggerFunc(func(lvl LogLevel, msg string, args ...interface{}) {
+		if lvl < level {
+			return
+		}
+		var b strings.Builder
+		b.WriteString(lvl.String())
+		b.WriteByte(' ')
+		b.WriteString(msg)
+		for i := 0; i < len(args); i += 2 {
+			if i+1 < len(args) {
+				fmt.Fprintf(&b, " %v=%v", args[i], args[i+1])
+			} else {
+				fmt.Fprintf(&b, " %v", args[i])
+			}
+		}
+		l.Print(b.String())
+	})
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Debug(string, ...interface{}) {}
+func (nopLogger) Info(string, ...interface{})  {}
+func (nopLogger) Warn(string, ...interface{})  {}
+func (nopLogger) Error(string, ...interface{}) {}
+
+// redacted replaces the sensitive values in the logs.
+const redacted = "REDACTED"
+
+// sensitiveKeys are the query parameters and headers always redacted, see WithRedactedKeys.
+var sensitiveKeys = []string{
+	"authorization", "proxy-authorization", "cookie", "set-cookie",
+	"token", "access_token", "refresh_token", "auth", "password", "pwd", "secret", "key", "apikey", "api_key",
+}
+
+func (opts *Options) logger() Logger {
+	if opts.Logger == nil {
+		return nopLogger{}
+	}
+	return opts.Logger
+}
+
+func (opts *Options) isSensitive(key string) bool {
+	for _, keys := range [][]string{sensitiveKeys, opts.RedactedKeys} {
+		for _, k := range keys {
+			if strings.EqualFold(k, key) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// redactURL returns u as a string, with the values of the sensitive query parameters and the password redacted.
+func (opts *Options) redactURL(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	r := *u
+	if _, ok := r.User.Password(); ok {
+		r.User = url.UserPassword(r.User.Username(), redacted)
+	}
+	q := r.Query()
+	for k := range q {
+		if opts.isSensitive(k) {
+			q[k] = []string{redacted}
+		}
+	}
+	r.RawQuery = q.Encode()
+	return r.String()
+}
+
+// redactError returns err to log, with the url of the errors of the http
+// client redacted like redactURL does.
+func (opts *Options) redactError(err error) error {
+	var ue *url.Error
+	if !errors.As(err, &ue) {
+		return err
+	}
+	r := redacted
+	if u, perr := url.Parse(ue.URL); perr == nil {
+		r = opts.redactURL(u)
+	}
+	return errors.New(strings.ReplaceAll(err.Error(), ue.URL, r))
+}
+
+// redactHeader returns a copy of h with the values of the sensitive headers redacted.
+func (opts *Options) redactHeader(h http.Header) http.Header {
+	r := make(http.Header, len(h))
+	for k, v := range h {
+		if opts.isSensitive(k) {
+			v = []string{redacted}
+		}
+		r[k] = v
+	}
+	return r
+}
@@ -0,0 +1,45 @@
+package socketio_client
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestLogsRedactURLErrors(t *testing.T) {
+	s := httptest.NewServer(nil)
+	addr := s.URL
+	s.Close()
+
+	var mu sync.Mutex
+	var logs []string
+	logger := LoggerFunc(func(level LogLevel, msg string, args ...interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+		logs = append(logs, fmt.Sprint(msg, args))
+	})
+	_, err := NewClient(WithAddr(addr), WithQueryKvs("token", "s3cr3t", "room", "lobby"), WithLogger(logger))
+	if err == nil {
+		t.Fatal("connected to a closed server")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	var failed bool
+	for _, l := range logs {
+		if strings.Contains(l, "s3cr3t") {
+			t.Errorf("log leaks the token: %s", l)
+		}
+		if strings.Contains(l, "connect failed") {
+			failed = true
+			if !strings.Contains(l, "token="+redacted) || !strings.Contains(l, "room=lobby") {
+				t.Errorf("connect failed log does not hold the redacted url: %s", l)
+			}
+		}
+	}
+	if !failed {
+		t.Fatalf("no connect failed log in %q", logs)
+	}
+}
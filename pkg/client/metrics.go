@@ -0,0 +1,136 @@
+package socketio_client
+
+import (
+	"io"
+	"time"
+
+	"github.com/weblfe/webss/pkg/parser"
+)
+
+// Metrics receives the measures of the client, see NewPrometheusMetrics. Its
+// methods are called from the goroutines of the client and must not block.
+type Metrics interface {
+	// PacketSent and PacketReceived count the packets with their size in
+	// bytes, event is the name of the event or the type of the packet. The
+	// events received without a listener are all counted as "other", their
+	// names come from the server.
+	PacketSent(namespace, event string, bytes int)
+	PacketReceived(namespace, event string, bytes int)
+	// AckRoundTrip measures the time between an emit and its ack.
+	AckRoundTrip(namespace string, d time.Duration)
+	// PendingAcks changes the number of the acks waited by delta.
+	PendingAcks(namespace string, delta int)
+	// PingRoundTrip measures the time between a ping and its pong, only
+	// known when the client sends the pings, with EIO=3.
+	PingRoundTrip(d time.Duration)
+	// Reconnect counts the reconnection attempts, err is nil when it succeeded.
+	Reconnect(err error)
+	// Upgrade counts the upgrades to transport, err is nil when it succeeded.
+	Upgrade(transport string, err error)
+	// DecodeError counts the packets which could not be decoded.
+	DecodeError()
+}
+
+type nopMetrics struct{}
+
+func (nopMetrics) PacketSent(string, string, int)     {}
+func (nopMetrics) PacketReceived(string, string, int) {}
+func (nopMetrics) AckRoundTrip(string, time.Duration) {}
+func (nopMetrics) PendingAcks(string, int)            {}
+func (nopMetrics) PingRoundTrip(time.Duration)        {}
+func (nopMetrics) Reconnect(error)                    {}
+func (nopMetrics) Upgrade(string, error)              {}
+func (nopMetrics) DecodeError()                       {}
+
+func (opts *Options) metrics() Metrics {
+	if opts.Metrics == nil {
+		return nopMetrics{}
+	}
+	return opts.Metrics
+}
+
+// packetEvent returns the event label of a packet of type t, the message of
+// the events or the type of the others.
+func packetEvent(t parser.Type, message string) string {
+	if t == parser.EVENT || t == parser.BINARY_EVENT {
+		return message
+	}
+	return t.String()
+}
+
+// otherEvent labels the events received without a listener.
+const otherEvent = "other"
+
+// receivedEvent returns the event label of a packet received by the
+// namespace, like packetEvent but only naming the events it listens to.
+func (client *Client) receivedEvent(t parser.Type, message string) string {
+	if t != parser.EVENT && t != parser.BINARY_EVENT {
+		return t.String()
+	}
+	client.eventsLock.RLock()
+	defer client.eventsLock.RUnlock()
+	if len(client.events[message]) == 0 {
+		return otherEvent
+	}
+	return message
+}
+
+// encode sends p through w and reports it to the metrics.
+func (client *Client) encode(w parser.FrameWriter, p parser.Packet) error {
+	c := &countingConn{w: w}
+	if err := parser.NewEncoder(c).Encode(p); err != nil {
+		return err
+	}
+	var message string
+	if args, ok := p.Data.([]interface{}); ok && len(args) > 0 {
+		message, _ = args[0].(string)
+	}
+	client.opts.metrics().PacketSent(client.namespace, packetEvent(p.Type, message), c.n)
+	return nil
+}
+
+// countingConn counts the bytes of the frames written to w or read from r,
+// the attachments left unread by the handlers are not drained to count them.
+type countingConn struct {
+	r parser.FrameReader
+	w parser.FrameWriter
+	n int
+}
+
+func (c *countingConn) NextWriter(t MessageType) (io.WriteCloser, error) {
+	w, err := c.w.NextWriter(t)
+	if err != nil {
+		return nil, err
+	}
+	return &countingWriter{WriteCloser: w, n: &c.n}, nil
+}
+
+func (c *countingConn) NextReader() (MessageType, io.ReadCloser, error) {
+	t, r, err := c.r.NextReader()
+	if err != nil {
+		return t, nil, err
+	}
+	return t, &countingReader{ReadCloser: r, n: &c.n}, nil
+}
+
+type countingWriter struct {
+	io.WriteCloser
+	n *int
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.WriteCloser.Write(p)
+	*w.n += n
+	return n, err
+}
+
+type countingReader struct {
+	io.ReadCloser
+	n *int
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	*r.n += n
+	return n, err
+}
@@ -0,0 +1,244 @@
+package socketio_client
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultBuckets are the upper bounds of the histograms, in seconds.
+var defaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// PrometheusMetrics is a Metrics rendering its measures in the Prometheus
+// text format when served over HTTP. It can be shared by several clients.
+//
+// For example:
+//
+//	metrics := socketio_client.NewPrometheusMetrics()
+//	http.Handle("/metrics", metrics)
+//	client, err := socketio_client.NewClient(socketio_client.WithMetrics(metrics))
+type PrometheusMetrics struct {
+	lock       sync.Mutex
+	counters   map[string]map[string]float64 // name, labels
+	gauges     map[string]map[string]float64
+	histograms map[string]map[string]*histogram
+}
+
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+type metricInfo struct {
+	kind string
+	help string
+}
+
+var metricInfos = map[string]metricInfo{
+	"socketio_client_packets_sent_total":       {"counter", "Packets sent, by namespace and event."},
+	"socketio_client_bytes_sent_total":         {"counter", "Bytes sent, by namespace and event."},
+	"socketio_client_packets_received_total":   {"counter", "Packets received, by namespace and event."},
+	"socketio_client_bytes_received_total":     {"counter", "Bytes received, by namespace and event."},
+	"socketio_client_ack_round_trip_seconds":   {"histogram", "Time between an emit and its ack."},
+	"socketio_client_pending_acks":             {"gauge", "Acks waited."},
+	"socketio_client_ping_round_trip_seconds":  {"histogram", "Time between a ping and its pong."},
+	"socketio_client_reconnect_attempts_total": {"counter", "Reconnection attempts, by result."},
+	"socketio_client_upgrades_total":           {"counter", "Transport upgrades, by transport and result."},
+	"socketio_client_decode_errors_total":      {"counter", "Packets which could not be decoded."},
+}
+
+func NewPrometheusMetrics() *PrometheusMetrics {
+	return &PrometheusMetrics{
+		counters:   make(map[string]map[string]float64),
+		gauges:     make(map[string]map[string]float64),
+		histograms: make(map[string]map[string]*histogram),
+	}
+}
+
+func (m *PrometheusMetrics) PacketSent(namespace, event string, bytes int) {
+	l := labels("namespace", namespace, "event", event)
+	m.add("socketio_client_packets_sent_total", l, 1)
+	m.add("socketio_client_bytes_sent_total", l, float64(bytes))
+}
+
+func (m *PrometheusMetrics) PacketReceived(namespace, event string, bytes int) {
+	l := labels("namespace", namespace, "event", event)
+	m.add("socketio_client_packets_received_total", l, 1)
+	m.add("socketio_client_bytes_received_total", l, float64(bytes))
+}
+
+func (m *PrometheusMetrics) AckRoundTrip(namespace string, d time.Duration) {
+	m.observe("socketio_client_ack_round_trip_seconds", labels("namespace", namespace), d.Seconds())
+}
+
+func (m *PrometheusMetrics) PendingAcks(namespace string, delta int) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	name := "socketio_client_pending_acks"
+	if m.gauges[name] == nil {
+		m.gauges[name] = make(map[string]float64)
+	}
+	m.gauges[name][labels("namespace", namespace)] += float64(delta)
+}
+
+func (m *PrometheusMetrics) PingRoundTrip(d time.Duration) {
+	m.observe("socketio_client_ping_round_trip_seconds", "", d.Seconds())
+}
+
+func (m *PrometheusMetrics) Reconnect(err error) {
+	m.add("socketio_client_reconnect_attempts_total", labels("result", result(err)), 1)
+}
+
+func (m *PrometheusMetrics) Upgrade(transport string, err error) {
+	m.add("socketio_client_upgrades_total", labels("transport", transport, "result", result(err)), 1)
+}
+
+func (m *PrometheusMetrics) DecodeError() {
+	m.add("socketio_client_decode_errors_total", "", 1)
+}
+
+func (m *PrometheusMetrics) add(name, labels string, v float64) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.counters[name] == nil {
+		m.counters[name] = make(map[string]float64)
+	}
+	m.counters[name][labels] += v
+}
+
+func (m *PrometheusMetrics) observe(name, labels string, v float64) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.histograms[name] == nil {
+		m.histograms[name] = make(map[string]*histogram)
+	}
+	h := m.histograms[name][labels]
+	if h == nil {
+		h = &histogram{counts: make([]uint64, len(defaultBuckets))}
+		m.histograms[name][labels] = h
+	}
+	for i, b := range defaultBuckets {
+		if v <= b {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+func (m *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
+
+// WriteTo writes the measures to w in the Prometheus text format.
+func (m *PrometheusMetrics) WriteTo(w io.Writer) (int64, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	var b strings.Builder
+	for _, name := range sortedKeys(metricInfos) {
+		info := metricInfos[name]
+		var samples []string
+		switch info.kind {
+		case "counter":
+			samples = renderValues(name, m.counters[name])
+		case "gauge":
+			samples = renderValues(name, m.gauges[name])
+		case "histogram":
+			samples = renderHistograms(name, m.histograms[name])
+		}
+		if len(samples) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", name, info.help, name, info.kind)
+		for _, s := range samples {
+			b.WriteString(s)
+		}
+	}
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+func renderValues(name string, values map[string]float64) []string {
+	var samples []string
+	for _, l := range sortedKeys(values) {
+		samples = append(samples, fmt.Sprintf("%s%s %s\n", name, wrapLabels(l), formatFloat(values[l])))
+	}
+	return samples
+}
+
+func renderHistograms(name string, histograms map[string]*histogram) []string {
+	var samples []string
+	for _, l := range sortedKeys(histograms) {
+		h := histograms[l]
+		var cumulative uint64
+		for i, bound := range defaultBuckets {
+			cumulative += h.counts[i]
+			samples = append(samples, fmt.Sprintf("%s_bucket%s %d\n", name, wrapLabels(joinLabels(l, labels("le", formatFloat(bound)))), cumulative))
+		}
+		samples = append(samples,
+			fmt.Sprintf("%s_bucket%s %d\n", name, wrapLabels(joinLabels(l, labels("le", "+Inf"))), h.count),
+			fmt.Sprintf("%s_sum%s %s\n", name, wrapLabels(l), formatFloat(h.sum)),
+			fmt.Sprintf("%s_count%s %d\n", name, wrapLabels(l), h.count))
+	}
+	return samples
+}
+
+// labels renders the label pairs kvs as `k1="v1",k2="v2"`.
+func labels(kvs ...string) string {
+	var b strings.Builder
+	for i := 0; i+1 < len(kvs); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(kvs[i])
+		b.WriteString(`="`)
+		b.WriteString(labelEscaper.Replace(kvs[i+1]))
+		b.WriteByte('"')
+	}
+	return b.String()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func joinLabels(a, b string) string {
+	if a == "" {
+		return b
+	}
+	return a + "," + b
+}
+
+func wrapLabels(l string) string {
+	if l == "" {
+		return ""
+	}
+	return "{" + l + "}"
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func result(err error) string {
+	if err != nil {
+		return "failure"
+	}
+	return "success"
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,53 @@
+package socketio_client
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsLabelListenedEvents(t *testing.T) {
+	s := startTestServer(t)
+	metrics := NewPrometheusMetrics()
+	c, err := NewClient(WithAddr(s.URL), WithTransports("websocket"), WithReconnection(false), WithMetrics(metrics))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	got := make(chan string, 1)
+	c.On("chat", func(msg string) { got <- msg })
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := c.WaitConnect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	sess := s.Sessions()[0]
+	sess.Emit(`2["spam-1","x"]`)
+	sess.Emit(`2["spam-2","x"]`)
+	sess.Emit(`2["chat","hi"]`)
+	select {
+	case <-got:
+	case <-time.After(2 * time.Second):
+		t.Fatal("chat not received")
+	}
+
+	var out string
+	scrape := func() bool {
+		rec := httptest.NewRecorder()
+		metrics.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+		b, _ := io.ReadAll(rec.Body)
+		out = string(b)
+		return strings.Contains(out, `event="chat"`)
+	}
+	// the packet is counted once its handler returned.
+	waitFor(t, 2*time.Second, "the chat packet to be counted", scrape)
+	if !strings.Contains(out, `event="other"`) {
+		t.Errorf("metrics miss event=\"other\":\n%s", out)
+	}
+	if strings.Contains(out, "spam") {
+		t.Errorf("metrics label the events without listener:\n%s", out)
+	}
+}
@@ -0,0 +1,194 @@
+package socketio_client
+
+import (
+	"context"
+	"sync"
+
+	"github.com/weblfe/webss/pkg/parser"
+)
+
+func newNamespace(root *Client, ns string) *Client {
+	client := &Client{
+		namespace:   ns,
+		root:        root,
+		eventsLock:  sync.RWMutex{},
+		events:      make(map[string][]eventListener),
+		ackMap:      make(map[int]*ack),
+		connectDone: make(chan struct{}),
+	}
+	if root == nil {
+		client.root = client
+	} else {
+		client.opts = root.opts
+		client.url = root.url
+	}
+	return client
+}
+
+// Io opens the namespace ns on the connection of client and returns it, or
+// returns it directly when it is already open. The CONNECT packet is sent
+// without waiting for the answer of the server, see WaitConnect. A namespace
+// disconnected is opened again with its listeners.
+func (client *Client) Io(ns string) *Client {
+	root := client.root
+	root.nspLock.Lock()
+	nsp, ok := root.nsps[ns]
+	// before Connect, the namespace is connected by it.
+	dialed := root.getConn() != nil
+	if !ok {
+		switch {
+		case root.left[ns] != nil:
+			nsp = root.left[ns]
+			delete(root.left, ns)
+		case ns == root.namespace:
+			nsp = root
+		default:
+			nsp = newNamespace(root, ns)
+		}
+		root.nsps[ns] = nsp
+	}
+	root.nspLock.Unlock()
+	if !ok {
+		nsp.resetConnect()
+		if dialed {
+			nsp.connect()
+		}
+	}
+	return nsp
+}
+
+// WaitConnect blocks until the server accepted the namespace, opening it again
+// if it was disconnected. It returns a *ConnectError when the server refused it,
+// or Err when the client stopped.
+func (client *Client) WaitConnect(ctx context.Context) error {
+	if err := client.Err(); err != nil {
+		return err
+	}
+	client.Io(client.namespace)
+
+	client.connectLock.Lock()
+	if client.connected {
+		client.connectLock.Unlock()
+		return nil
+	}
+	done := client.connectDone
+	client.connectLock.Unlock()
+
+	select {
+	case <-done:
+		client.connectLock.Lock()
+		defer client.connectLock.Unlock()
+		return client.connectErr
+	case <-client.Done():
+		return client.Err()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Disconnect leaves the namespace: the server is sent a DISCONNECT packet, the
+// pending acks fail and no packet of the namespace is dispatched until it is opened again.
+func (client *Client) Disconnect() error {
+	client.unregister()
+
+	packet := parser.Packet{
+		Type: parser.DISCONNECT,
+		Id:   -1,
+		NSP:  client.namespace,
+	}
+	var err error
+	if conn := client.getConn(); conn != nil {
+		err = client.encode(conn, packet)
+	}
+	client.onClose(ReasonIoClientDisconnect)
+	return err
+}
+
+// unregister stops dispatching the packets of the namespace, Io opens it again.
+func (client *Client) unregister() {
+	root := client.root
+	root.nspLock.Lock()
+	defer root.nspLock.Unlock()
+	if root.nsps[client.namespace] == client {
+		delete(root.nsps, client.namespace)
+		root.left[client.namespace] = client
+	}
+}
+
+func (client *Client) getNamespace(ns string) *Client {
+	if ns == "" {
+		ns = "/"
+	}
+	root := client.root
+	root.nspLock.Lock()
+	defer root.nspLock.Unlock()
+	return root.nsps[ns]
+}
+
+func (client *Client) namespaces() []*Client {
+	root := client.root
+	root.nspLock.Lock()
+	defer root.nspLock.Unlock()
+	nsps := make([]*Client, 0, len(root.nsps))
+	for _, nsp := range root.nsps {
+		nsps = append(nsps, nsp)
+	}
+	return nsps
+}
+
+// onClose reports the namespace is no longer usable, because it was left or
+// the connection was lost.
+func (client *Client) onClose(reason DisconnectReason) {
+	client.failAcks(DisconnectedError)
+	if client.setDisconnected() {
+		client.callDisconnect(reason)
+	}
+}
+
+// resetConnect starts waiting for the answer to a new CONNECT packet, keeping
+// the callers of WaitConnect which are still waiting for the previous one.
+func (client *Client) resetConnect() {
+	client.connectLock.Lock()
+	defer client.connectLock.Unlock()
+	client.connected = false
+	client.sid = ""
+	select {
+	case <-client.connectDone:
+		client.connectDone = make(chan struct{})
+		client.connectErr = nil
+	default:
+	}
+}
+
+func (client *Client) setConnected(sid string, err error) {
+	client.connectLock.Lock()
+	defer client.connectLock.Unlock()
+	client.sid = sid
+	client.connected = err == nil
+	client.connectErr = err
+	select {
+	case <-client.connectDone:
+	default:
+		close(client.connectDone)
+	}
+	if err == nil {
+		go client.flush()
+	}
+}
+
+// setDisconnected marks the namespace disconnected and tells whether it was
+// connected, WaitConnect then waits for the namespace to be connected again.
+func (client *Client) setDisconnected() bool {
+	client.connectLock.Lock()
+	defer client.connectLock.Unlock()
+	connected := client.connected
+	client.connected = false
+	client.sid = ""
+	select {
+	case <-client.connectDone:
+		client.connectDone = make(chan struct{})
+		client.connectErr = nil
+	default:
+	}
+	return connected
+}
@@ -0,0 +1,127 @@
+package socketio_client
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ackWithNamespace acks the events with the namespace they were sent on.
+func ackWithNamespace(sess *testSession, p string) {
+	nsp := "/"
+	if strings.HasPrefix(p, "2/") {
+		nsp = p[1:strings.IndexByte(p, ',')]
+	}
+	if ack, ok := ackOf(p, `["`+nsp+`"]`); ok {
+		sess.Emit(ack)
+	}
+}
+
+func waitConnect(t *testing.T, nsp *Client) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := nsp.WaitConnect(ctx); err != nil {
+		t.Fatalf("%s: %v", nsp.Namespace(), err)
+	}
+}
+
+func TestNamespaceMultiplexing(t *testing.T) {
+	s := startTestServer(t)
+	s.OnPacket = ackWithNamespace
+	c := connectTestClient(t, s)
+	chat, news := c.Io("/chat"), c.Io("/news")
+	if c.Io("/chat") != chat {
+		t.Fatal("Io returned another client for an open namespace")
+	}
+	waitConnect(t, chat)
+	waitConnect(t, news)
+	if chat.Id() != "sid1-nsp" || news.Id() != "sid1-nsp" {
+		t.Fatalf("ids %q %q", chat.Id(), news.Id())
+	}
+
+	got := make(chan string, 3)
+	for _, nsp := range []*Client{c, chat, news} {
+		nsp := nsp
+		nsp.On("hello", func(s string) { got <- nsp.Namespace() + " " + s })
+	}
+	sess := s.Sessions()[0]
+	sess.Emit(`2/news,["hello","n"]`)
+	sess.Emit(`2/chat,["hello","c"]`)
+	sess.Emit(`2["hello","m"]`)
+	for _, want := range []string{"/news n", "/chat c", "/ m"} {
+		select {
+		case g := <-got:
+			if g != want {
+				t.Fatalf("received %q, want %q", g, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("%q not received", want)
+		}
+	}
+
+	// each namespace numbers its acks, from 0.
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	for i := 0; i < 2; i++ {
+		for _, nsp := range []*Client{chat, news} {
+			res, err := nsp.EmitWithAck(ctx, "ping")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(res) != 1 || res[0] != nsp.Namespace() {
+				t.Fatalf("%s: ack %v", nsp.Namespace(), res)
+			}
+		}
+	}
+	if chat.id != 2 || news.id != 2 {
+		t.Fatalf("next ack ids %d %d", chat.id, news.id)
+	}
+}
+
+func TestNamespaceReopen(t *testing.T) {
+	s := startTestServer(t)
+	c := connectTestClient(t, s)
+	chat := c.Io("/chat")
+	got := make(chan string, 1)
+	chat.On("hello", func(s string) { got <- s })
+	waitConnect(t, chat)
+	sess := s.Sessions()[0]
+
+	receive := func(want string) {
+		t.Helper()
+		sess.Emit(`2/chat,["hello","` + want + `"]`)
+		select {
+		case g := <-got:
+			if g != want {
+				t.Fatalf("received %q, want %q", g, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("%q not received", want)
+		}
+	}
+
+	// left by the client.
+	if err := chat.Disconnect(); err != nil {
+		t.Fatal(err)
+	}
+	waitConnect(t, chat)
+	if c.Io("/chat") != chat {
+		t.Fatal("Io returned another client for the namespace opened again")
+	}
+	receive("after Disconnect")
+
+	// left by the server.
+	disconnected := make(chan DisconnectReason, 2)
+	chat.OnDisconnect(func(reason DisconnectReason) { disconnected <- reason })
+	sess.Emit(`1/chat,`)
+	if reason := <-disconnected; reason != ReasonIoServerDisconnect {
+		t.Fatalf("disconnected for %s", reason)
+	}
+	if c.Io("/chat") != chat {
+		t.Fatal("Io returned another client for the namespace left by the server")
+	}
+	waitConnect(t, chat)
+	receive("after the server disconnect")
+}
@@ -0,0 +1,356 @@
+package socketio_client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// testServer is a socket.io v5 server over engine.io v4, enough to drive the
+// client: it opens the sessions over polling or websocket, answers the
+// upgrade probe, sends the pings, connects the namespaces and hands the other
+// socket.io packets to OnPacket.
+type testServer struct {
+	*httptest.Server
+
+	PingInterval time.Duration
+	PingTimeout  time.Duration
+	Upgrades     []string
+	// Refuse, when set, answers the CONNECT packets with a CONNECT_ERROR of this message.
+	Refuse string
+	// OnPacket receives the socket.io packets other than CONNECT, without the
+	// engine.io type.
+	OnPacket func(s *testSession, packet string)
+	// OnConnect receives the CONNECT packets before they are answered.
+	OnConnect func(s *testSession, packet string)
+	// OnRequest receives the HTTP requests before they are served, see requestKind.
+	OnRequest func(w http.ResponseWriter, r *http.Request)
+
+	mu       sync.Mutex
+	sessions map[string]*testSession
+	seq      int
+}
+
+func newTestServer(t *testing.T) *testServer {
+	s := &testServer{
+		PingInterval: 300 * time.Millisecond,
+		PingTimeout:  300 * time.Millisecond,
+		sessions:     map[string]*testSession{},
+	}
+	s.Server = httptest.NewUnstartedServer(s)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func startTestServer(t *testing.T) *testServer {
+	s := newTestServer(t)
+	s.Start()
+	return s
+}
+
+// Close closes the sessions, then the server.
+func (s *testServer) Close() {
+	s.mu.Lock()
+	sessions := s.sessions
+	s.sessions = map[string]*testSession{}
+	s.mu.Unlock()
+	for _, sess := range sessions {
+		sess.close()
+	}
+	s.Server.CloseClientConnections()
+	s.Server.Close()
+}
+
+// Sessions returns the sessions opened so far.
+func (s *testServer) Sessions() []*testSession {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ret := make([]*testSession, 0, len(s.sessions))
+	for _, sess := range s.sessions {
+		ret = append(ret, sess)
+	}
+	return ret
+}
+
+// testSession is an engine.io session of the testServer.
+type testSession struct {
+	s      *testServer
+	sid    string
+	mu     sync.Mutex
+	ws     *websocket.Conn
+	queue  chan string
+	closed chan struct{}
+	once   sync.Once
+}
+
+// Emit sends the socket.io packet p.
+func (sess *testSession) Emit(p string) {
+	sess.send("4" + p)
+}
+
+func (sess *testSession) send(p string) {
+	sess.mu.Lock()
+	ws := sess.ws
+	if ws != nil {
+		ws.WriteMessage(websocket.TextMessage, []byte(p))
+		sess.mu.Unlock()
+		return
+	}
+	sess.mu.Unlock()
+	select {
+	case sess.queue <- p:
+	case <-sess.closed:
+	}
+}
+
+func (sess *testSession) close() {
+	sess.once.Do(func() {
+		close(sess.closed)
+		sess.mu.Lock()
+		if sess.ws != nil {
+			sess.ws.Close()
+		}
+		sess.mu.Unlock()
+	})
+}
+
+// releasePolls answers the pending polls with a noop until the upgrade, like
+// the engine.io servers: the client waits for its poll to return to upgrade.
+func (sess *testSession) releasePolls() {
+	for {
+		sess.mu.Lock()
+		upgraded := sess.ws != nil
+		sess.mu.Unlock()
+		if upgraded {
+			return
+		}
+		if len(sess.queue) == 0 {
+			select {
+			case sess.queue <- "6":
+			default:
+			}
+		}
+		select {
+		case <-time.After(50 * time.Millisecond):
+		case <-sess.closed:
+			return
+		}
+	}
+}
+
+func (sess *testSession) pingLoop() {
+	for {
+		select {
+		case <-time.After(sess.s.PingInterval):
+			sess.send("2")
+		case <-sess.closed:
+			return
+		}
+	}
+}
+
+func (sess *testSession) onPacket(p string) {
+	switch {
+	case p == "1":
+		sess.close()
+	case strings.HasPrefix(p, "40"):
+		nsp := ""
+		if i := strings.IndexByte(p, ','); strings.HasPrefix(p, "40/") && i > 0 {
+			nsp = p[2 : i+1]
+		} else if strings.HasPrefix(p, "40/") {
+			nsp = p[2:] + ","
+		}
+		if f := sess.s.OnConnect; f != nil {
+			f(sess, p[1:])
+		}
+		if sess.s.Refuse != "" {
+			sess.Emit(fmt.Sprintf(`4%s{"message":%q}`, nsp, sess.s.Refuse))
+			return
+		}
+		sess.Emit(fmt.Sprintf(`0%s{"sid":"%s-nsp"}`, nsp, sess.sid))
+	case strings.HasPrefix(p, "4"):
+		if f := sess.s.OnPacket; f != nil {
+			f(sess, p[1:])
+		}
+	}
+}
+
+func (s *testServer) open(sid string) *testSession {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sid != "" {
+		return s.sessions[sid]
+	}
+	s.seq++
+	sess := &testSession{
+		s:      s,
+		sid:    fmt.Sprintf("sid%d", s.seq),
+		queue:  make(chan string, 64),
+		closed: make(chan struct{}),
+	}
+	s.sessions[sess.sid] = sess
+	go sess.pingLoop()
+	return sess
+}
+
+func (s *testServer) handshake(sess *testSession) string {
+	upgrades := `[]`
+	if len(s.Upgrades) > 0 {
+		upgrades = `["` + strings.Join(s.Upgrades, `","`) + `"]`
+	}
+	return fmt.Sprintf(`0{"sid":"%s","upgrades":%s,"pingInterval":%d,"pingTimeout":%d,"maxPayload":1000000}`,
+		sess.sid, upgrades, s.PingInterval.Milliseconds(), s.PingTimeout.Milliseconds())
+}
+
+// requestKind names the engine.io request r: handshake, poll, send or upgrade.
+func requestKind(r *http.Request) string {
+	q := r.URL.Query()
+	switch {
+	case q.Get("sid") == "":
+		return "handshake"
+	case q.Get("transport") == "websocket":
+		return "upgrade"
+	case r.Method == http.MethodPost:
+		return "send"
+	}
+	return "poll"
+}
+
+func (s *testServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if f := s.OnRequest; f != nil {
+		f(w, r)
+	}
+	q := r.URL.Query()
+	sid := q.Get("sid")
+	if q.Get("transport") == "websocket" {
+		s.serveWebsocket(w, r, sid)
+		return
+	}
+	if sid == "" {
+		io.WriteString(w, s.handshake(s.open("")))
+		return
+	}
+	sess := s.open(sid)
+	if sess == nil {
+		http.Error(w, "unknown sid", http.StatusBadRequest)
+		return
+	}
+	if r.Method == http.MethodPost {
+		b, _ := io.ReadAll(r.Body)
+		for _, p := range strings.Split(string(b), "\x1e") {
+			sess.onPacket(p)
+		}
+		io.WriteString(w, "ok")
+		return
+	}
+	select {
+	case p := <-sess.queue:
+		packets := []string{p}
+		for len(sess.queue) > 0 {
+			packets = append(packets, <-sess.queue)
+		}
+		io.WriteString(w, strings.Join(packets, "\x1e"))
+	case <-sess.closed:
+		io.WriteString(w, "1")
+	case <-r.Context().Done():
+	}
+}
+
+func (s *testServer) serveWebsocket(w http.ResponseWriter, r *http.Request, sid string) {
+	var sess *testSession
+	if sid != "" {
+		if sess = s.open(sid); sess == nil {
+			http.Error(w, "unknown sid", http.StatusBadRequest)
+			return
+		}
+	}
+	up := websocket.Upgrader{}
+	ws, err := up.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer ws.Close()
+	if sess == nil {
+		sess = s.open("")
+		sess.mu.Lock()
+		sess.ws = ws
+		ws.WriteMessage(websocket.TextMessage, []byte(s.handshake(sess)))
+		sess.mu.Unlock()
+	}
+	for {
+		_, b, err := ws.ReadMessage()
+		if err != nil {
+			sess.close()
+			return
+		}
+		switch p := string(b); p {
+		case "2probe":
+			sess.mu.Lock()
+			ws.WriteMessage(websocket.TextMessage, []byte("3probe"))
+			sess.mu.Unlock()
+			go sess.releasePolls()
+		case "5":
+			sess.mu.Lock()
+			sess.ws = ws
+			sess.mu.Unlock()
+		default:
+			sess.onPacket(p)
+		}
+	}
+}
+
+// waitFor fails the test unless cond turns true within d.
+func waitFor(t *testing.T, d time.Duration, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(d)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// connectTestClient returns a client of s over websocket, without
+// reconnection, once its main namespace is connected.
+func connectTestClient(t *testing.T, s *testServer, opts ...Option) *Client {
+	t.Helper()
+	opts = append([]Option{WithAddr(s.URL), WithTransports("websocket"), WithReconnection(false)}, opts...)
+	c, err := NewClient(opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := c.WaitConnect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// ackOf returns the ack of the event packet p with the arguments args, e.g.
+// `3/chat,12["ok"]` for `2/chat,12["msg"]`, and false when p expects no ack.
+func ackOf(p string, args string) (string, bool) {
+	end := strings.IndexByte(p, '[')
+	if !strings.HasPrefix(p, "2") || end < 0 {
+		return "", false
+	}
+	head := p[1:end]
+	nsp := ""
+	if i := strings.IndexByte(head, ','); i >= 0 {
+		nsp, head = head[:i+1], head[i+1:]
+	}
+	if head == "" {
+		return "", false
+	}
+	return "3" + nsp + head + args, true
+}
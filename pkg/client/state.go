@@ -0,0 +1,96 @@
+package socketio_client
+
+// State is the state of the connection of a Client, shared by its namespaces.
+type State int
+
+const (
+	// StateConnecting is the state of a new client, until its connection is open.
+	// Without Options.AutoConnect, it lasts until Connect opened it.
+	StateConnecting State = iota
+	// StateConnected means the connection is open over its final transport.
+	StateConnected
+	// StateUpgrading means the connection is open and probing the websocket transport.
+	StateUpgrading
+	// StateReconnecting means the connection was lost and is being dialed again.
+	StateReconnecting
+	// StateDisconnected means the connection was lost for good, the client only can be closed.
+	StateDisconnected
+	// StateClosed means Close was called, it is the final state.
+	StateClosed
+)
+
+var stateNames = map[State]string{
+	StateConnecting:   "connecting",
+	StateConnected:    "connected",
+	StateUpgrading:    "upgrading",
+	StateReconnecting: "reconnecting",
+	StateDisconnected: "disconnected",
+	StateClosed:       "closed",
+}
+
+func (s State) String() string {
+	if name, ok := stateNames[s]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// stateTransitions lists the states each state can move to.
+var stateTransitions = map[State][]State{
+	StateConnecting:   {StateConnected, StateUpgrading, StateDisconnected, StateClosed},
+	StateConnected:    {StateUpgrading, StateReconnecting, StateDisconnected, StateClosed},
+	StateUpgrading:    {StateConnected, StateReconnecting, StateDisconnected, StateClosed},
+	StateReconnecting: {StateConnected, StateUpgrading, StateDisconnected, StateClosed},
+	StateDisconnected: {StateClosed},
+	StateClosed:       {},
+}
+
+func canTransition(from, to State) bool {
+	for _, s := range stateTransitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// State returns the state of the connection.
+func (client *Client) State() State {
+	root := client.root
+	root.stateLock.Lock()
+	defer root.stateLock.Unlock()
+	return root.state
+}
+
+// OnStateChange adds f to the functions called with the old and the new state
+// whenever the state of the connection changes. They are called in order,
+// one transition at a time. To see the first connection open, register them
+// before Connect, see WithAutoConnect.
+func (client *Client) OnStateChange(f func(old, new State)) {
+	root := client.root
+	root.eventsLock.Lock()
+	defer root.eventsLock.Unlock()
+	root.lifecycle.onStateChange = append(root.lifecycle.onStateChange, f)
+}
+
+// setState moves the connection to state and tells whether it did, the
+// transitions stateTransitions does not list are ignored.
+func (client *Client) setState(state State) bool {
+	root := client.root
+	root.stateNotify.Lock()
+	defer root.stateNotify.Unlock()
+
+	root.stateLock.Lock()
+	old := root.state
+	if !canTransition(old, state) {
+		root.stateLock.Unlock()
+		return false
+	}
+	root.state = state
+	root.stateLock.Unlock()
+
+	for _, f := range root.getLifecycle().onStateChange {
+		f(old, state)
+	}
+	return true
+}
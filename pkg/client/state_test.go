@@ -0,0 +1,109 @@
+package socketio_client
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+var allStates = []State{StateConnecting, StateConnected, StateUpgrading, StateReconnecting, StateDisconnected, StateClosed}
+
+func TestStateTransitions(t *testing.T) {
+	allowed := map[State]map[State]bool{
+		StateConnecting:   {StateConnected: true, StateUpgrading: true, StateDisconnected: true, StateClosed: true},
+		StateConnected:    {StateUpgrading: true, StateReconnecting: true, StateDisconnected: true, StateClosed: true},
+		StateUpgrading:    {StateConnected: true, StateReconnecting: true, StateDisconnected: true, StateClosed: true},
+		StateReconnecting: {StateConnected: true, StateUpgrading: true, StateDisconnected: true, StateClosed: true},
+		StateDisconnected: {StateClosed: true},
+		StateClosed:       {},
+	}
+	if len(stateTransitions) != len(allStates) {
+		t.Fatalf("stateTransitions has %d states, want %d", len(stateTransitions), len(allStates))
+	}
+	for _, from := range allStates {
+		for _, to := range allStates {
+			want := allowed[from][to]
+			t.Run(from.String()+"->"+to.String(), func(t *testing.T) {
+				if got := canTransition(from, to); got != want {
+					t.Fatalf("canTransition = %v, want %v", got, want)
+				}
+
+				client := newNamespace(nil, "/")
+				client.state = from
+				var calls [][2]State
+				client.OnStateChange(func(old, new State) {
+					calls = append(calls, [2]State{old, new})
+				})
+				if got := client.setState(to); got != want {
+					t.Fatalf("setState = %v, want %v", got, want)
+				}
+				switch {
+				case want && client.State() != to:
+					t.Fatalf("State() = %v, want %v", client.State(), to)
+				case !want && client.State() != from:
+					t.Fatalf("rejected transition moved the state to %v", client.State())
+				case want && (len(calls) != 1 || calls[0] != [2]State{from, to}):
+					t.Fatalf("OnStateChange calls = %v", calls)
+				case !want && len(calls) != 0:
+					t.Fatalf("rejected transition called OnStateChange: %v", calls)
+				}
+			})
+		}
+	}
+}
+
+func TestStateString(t *testing.T) {
+	for _, s := range allStates {
+		if s.String() == "unknown" {
+			t.Errorf("state %d has no name", s)
+		}
+	}
+	if s := State(100).String(); s != "unknown" {
+		t.Errorf("State(100) = %q", s)
+	}
+}
+
+func TestStateOfConnection(t *testing.T) {
+	for _, test := range []struct {
+		transports []string
+		want       string
+	}{
+		{[]string{"websocket"}, "[connecting->connected]"},
+		{[]string{"polling", "websocket"}, "[connecting->connected connected->upgrading upgrading->connected]"},
+	} {
+		t.Run(fmt.Sprint(test.transports), func(t *testing.T) {
+			s := newTestServer(t)
+			s.Upgrades = []string{"websocket"}
+			s.Start()
+			c, err := NewClient(WithAddr(s.URL), WithTransports(test.transports...), WithReconnection(false), WithAutoConnect(false))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var r recorder
+			// registered before Connect, it sees the first connection.
+			c.OnStateChange(func(old, new State) { r.add(old.String() + "->" + new.String()) })
+			if err := c.Connect(); err != nil {
+				t.Fatal(err)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			if err := c.WaitConnect(ctx); err != nil {
+				t.Fatal(err)
+			}
+			waitFor(t, 2*time.Second, "transitions "+test.want, func() bool {
+				r.mu.Lock()
+				defer r.mu.Unlock()
+				return fmt.Sprint(r.calls) == test.want
+			})
+			r.take()
+			c.Close()
+			if st := c.State(); st != StateClosed {
+				t.Fatalf("State() = %v after Close, want closed", st)
+			}
+			if calls := r.take(); fmt.Sprint(calls) != "[connected->closed]" {
+				t.Fatalf("calls after Close %q", calls)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package socketio_client
+
+import (
+	"context"
+)
+
+// typedCaller is the handler of OnEvent and OnEventAck, it decodes the first
+// argument of the event into a T and calls f with it, without reflection.
+type typedCaller[T any, R any] struct {
+	f   func(T)
+	ack func(T) R
+}
+
+func (c *typedCaller[T, R]) GetArgs() []interface{} {
+	return []interface{}{new(T)}
+}
+
+func (c *typedCaller[T, R]) Handle(args []interface{}) ([]interface{}, error) {
+	var v T
+	if len(args) > 0 {
+		if p, ok := args[0].(*T); ok {
+			v = *p
+		}
+	}
+	if c.ack != nil {
+		return []interface{}{c.ack(v)}, nil
+	}
+	c.f(v)
+	return nil, nil
+}
+
+func (c *typedCaller[T, R]) CallWith(args ...interface{}) {
+	var v T
+	if len(args) > 0 {
+		v, _ = args[0].(T)
+	}
+	c.Handle([]interface{}{&v})
+}
+
+// OnEvent registers f as the handler of message, the first argument of the
+// event is decoded into a T. It is the type-safe form of Client.On.
+//
+// For example:
+//
+//	type Chat struct {
+//	    From string `json:"from"`
+//	    Text string `json:"text"`
+//	}
+//
+//	socketio_client.OnEvent(client, "chat", func(msg Chat) {
+//	    log.Printf("%s: %s", msg.From, msg.Text)
+//	})
+func OnEvent[T any](client *Client, message string, f func(T)) ListenerId {
+	return client.addListener(message, &typedCaller[T, struct{}]{f: f}, false)
+}
+
+// OnceEvent is like OnEvent but f is removed after its first call.
+func OnceEvent[T any](client *Client, message string, f func(T)) ListenerId {
+	return client.addListener(message, &typedCaller[T, struct{}]{f: f}, true)
+}
+
+// OnEventAck is like OnEvent, the value returned by f is sent as the ack of the event.
+func OnEventAck[T any, R any](client *Client, message string, f func(T) R) ListenerId {
+	return client.addListener(message, &typedCaller[T, R]{ack: f}, false)
+}
+
+// EmitAck emits message with req and waits for the ack of the server, whose
+// first argument is decoded into a Resp. It fails like Client.EmitWithAck.
+//
+// For example:
+//
+//	reply, err := socketio_client.EmitAck[JoinRequest, JoinReply](ctx, client, "join", JoinRequest{Room: "lobby"})
+func EmitAck[Req any, Resp any](ctx context.Context, client *Client, message string, req Req) (Resp, error) {
+	var resp Resp
+	err := client.EmitWithAckInto(ctx, []interface{}{&resp}, message, req)
+	return resp, err
+}
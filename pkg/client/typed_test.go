@@ -0,0 +1,132 @@
+package socketio_client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+type testJoin struct {
+	Room string `json:"room"`
+}
+
+type testJoined struct {
+	Ok   bool   `json:"ok"`
+	Room string `json:"room"`
+}
+
+// receivePackets hands the packets received by s to the returned channel.
+func receivePackets(s *testServer) chan string {
+	packets := make(chan string, 16)
+	s.OnPacket = func(_ *testSession, p string) { packets <- p }
+	return packets
+}
+
+func expectPacket(t *testing.T, packets chan string, want string) {
+	t.Helper()
+	select {
+	case p := <-packets:
+		if p != want {
+			t.Fatalf("server received %s, want %s", p, want)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("server did not receive %s", want)
+	}
+}
+
+func TestOnEvent(t *testing.T) {
+	s := startTestServer(t)
+	c := connectTestClient(t, s)
+	got := make(chan testJoin, 4)
+	OnEvent(c, "join", func(j testJoin) { got <- j })
+	once := make(chan testJoin, 4)
+	OnceEvent(c, "join", func(j testJoin) { once <- j })
+	sess := s.Sessions()[0]
+	sess.Emit(`2["join",{"room":"a"}]`)
+	sess.Emit(`2["join",{"room":"b"},"ignored"]`)
+	sess.Emit(`2["join"]`)
+	for _, want := range []string{"a", "b", ""} {
+		select {
+		case j := <-got:
+			if j.Room != want {
+				t.Fatalf("room %q, want %q", j.Room, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("room %q not received", want)
+		}
+	}
+	if len(once) != 1 || (<-once).Room != "a" {
+		t.Fatal("OnceEvent not called once with the first event")
+	}
+}
+
+// An argument which does not decode into T is an error of the connection,
+// the handler is not called.
+func TestOnEventDecodeMismatch(t *testing.T) {
+	s := startTestServer(t)
+	c := connectTestClient(t, s)
+	OnEvent(c, "join", func(j testJoin) { t.Errorf("handler called with %+v", j) })
+	errs := make(chan error, 1)
+	c.OnError(func(err error) { errs <- err })
+	s.Sessions()[0].Emit(`2["join",42]`)
+	select {
+	case err := <-errs:
+		var typeErr *json.UnmarshalTypeError
+		if !errors.As(err, &typeErr) {
+			t.Fatalf("OnError got %v, want a *json.UnmarshalTypeError", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("OnError not called")
+	}
+}
+
+func TestOnEventAck(t *testing.T) {
+	s := startTestServer(t)
+	packets := receivePackets(s)
+	c := connectTestClient(t, s)
+	OnEventAck(c, "join", func(j testJoin) testJoined {
+		return testJoined{Ok: true, Room: j.Room}
+	})
+	s.Sessions()[0].Emit(`27["join",{"room":"lobby"}]`)
+	expectPacket(t, packets, `3/,7[{"ok":true,"room":"lobby"}]`)
+}
+
+func TestEmitAck(t *testing.T) {
+	s := startTestServer(t)
+	packets := receivePackets(s)
+	c := connectTestClient(t, s)
+	type result struct {
+		reply testJoined
+		err   error
+	}
+	ret := make(chan result, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		reply, err := EmitAck[testJoin, testJoined](ctx, c, "join", testJoin{Room: "lobby"})
+		ret <- result{reply, err}
+	}()
+	expectPacket(t, packets, `2/,0["join",{"room":"lobby"}]`)
+	s.Sessions()[0].Emit(`30[{"ok":true,"room":"lobby"},"ignored"]`)
+	r := <-ret
+	if r.err != nil || r.reply != (testJoined{Ok: true, Room: "lobby"}) {
+		t.Fatalf("EmitAck = %+v, %v", r.reply, r.err)
+	}
+
+	// a reply which does not decode into Resp fails EmitAck.
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		reply, err := EmitAck[testJoin, testJoined](ctx, c, "join", testJoin{Room: "lobby"})
+		ret <- result{reply, err}
+	}()
+	expectPacket(t, packets, `2/,1["join",{"room":"lobby"}]`)
+	s.Sessions()[0].Emit(`31["no"]`)
+	r = <-ret
+	var typeErr *json.UnmarshalTypeError
+	if !errors.As(r.err, &typeErr) {
+		t.Fatalf("EmitAck = %+v, %v, want a *json.UnmarshalTypeError", r.reply, r.err)
+	}
+}
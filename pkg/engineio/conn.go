@@ -0,0 +1,675 @@
+package engineio
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	InvalidError     = errors.New("invalid transport")
+	PingTimeoutError = errors.New("ping timeout")
+	ProbeError       = errors.New("probe failed")
+	// MessageTooLargeError closes the connections receiving a message larger
+	// than Options.MaxMessageSize.
+	MessageTooLargeError = errors.New("message too large")
+)
+
+// State is the state of a Conn, it opens in StateOpening.
+type State int
+
+const (
+	StateOpening State = iota
+	StateOpen
+	StateUpgrading
+	StateClosing
+	StateClosed
+)
+
+func (s State) String() string {
+	switch s {
+	case StateOpening:
+		return "opening"
+	case StateOpen:
+		return "open"
+	case StateUpgrading:
+		return "upgrading"
+	case StateClosing:
+		return "closing"
+	case StateClosed:
+		return "closed"
+	}
+	return fmt.Sprintf("unknown(%d)", int(s))
+}
+
+// transport carries the packets of a session.
+type transport interface {
+	Name() string
+	NextReader() (*packetReader, error)
+	NextWriter(msgType MessageType, t PacketType) (io.WriteCloser, error)
+	Close() error
+}
+
+// Conn is an engine.io session. It answers the heartbeat and upgrades its
+// transport on its own, NextReader and NextWriter carry the messages.
+type Conn struct {
+	id              string
+	options         *Options
+	url             *url.URL
+	writerLocker    sync.Mutex
+	transportLocker sync.RWMutex
+	current         transport
+	upgrading       transport
+	probed          bool          // the upgrading transport answered the probe
+	upgradeDone     chan struct{} // closed once the upgrade is over
+	stateLocker     sync.RWMutex
+	state           State
+	readerChan      chan *connReader
+	pingChan        chan bool
+	pingTimeout     time.Duration
+	pingInterval    time.Duration
+	protocol        int
+	maxPayload      int
+	err             error         // why the connection closed
+	closing         chan struct{} // closed by Close
+	ctx             context.Context
+	cancel          context.CancelFunc // called by Close, aborts the requests and dials
+	closeOnce       sync.Once
+	wg              sync.WaitGroup
+}
+
+// Dial opens a session with the server at u, an http or https url with the
+// path of the engine.io endpoint. It tries the transports of the options in
+// order, then upgrades in the background to the following ones the server offers.
+func Dial(u *url.URL, opts *Options) (*Conn, error) {
+	return DialContext(context.Background(), u, opts)
+}
+
+// DialContext is like Dial, ctx aborts the handshake. Once the session is
+// open, ctx no longer matters.
+func DialContext(ctx context.Context, u *url.URL, opts *Options) (*Conn, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	transports := opts.transports()
+	for _, name := range transports {
+		if name != "polling" && name != "websocket" {
+			return nil, InvalidError
+		}
+	}
+
+	c := &Conn{
+		url:        u,
+		options:    opts,
+		pingChan:   make(chan bool),
+		readerChan: make(chan *connReader),
+		closing:    make(chan struct{}),
+	}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	var err error
+	for i, name := range transports {
+		var upgrades []string
+		upgrades, err = c.handshake(ctx, name)
+		if err != nil {
+			opts.logger().Warn("handshake failed", "transport", name, "err", logError(err))
+			continue
+		}
+		c.wg.Add(2)
+		go c.pingLoop()
+		go c.readLoop()
+		if next := upgradeTo(transports[i+1:], upgrades); next != "" {
+			c.wg.Add(1)
+			go c.probe(next)
+		}
+		return c, nil
+	}
+	c.cancel()
+	return nil, err
+}
+
+// upgradeTo returns the first of transports the server offers in upgrades.
+func upgradeTo(transports []string, upgrades []string) string {
+	for _, t := range transports {
+		for _, u := range upgrades {
+			if t == u && t == "websocket" {
+				return t
+			}
+		}
+	}
+	return ""
+}
+
+// handshake opens the session over the transport name and returns the
+// upgrades offered by the server.
+func (c *Conn) handshake(ctx context.Context, name string) ([]string, error) {
+	u := *c.url
+	q := u.Query()
+	q.Set("transport", name)
+	eio := c.options.EIO
+	switch {
+	case eio > 0:
+		q.Set("EIO", strconv.Itoa(eio))
+	case q.Get("EIO") == "":
+		// ask for the latest revision, the handshake tells what the server speaks.
+		q.Set("EIO", "4")
+	default:
+		eio, _ = strconv.Atoi(q.Get("EIO"))
+	}
+	q.Del("sid")
+	u.RawQuery = q.Encode()
+	requested, _ := strconv.Atoi(q.Get("EIO"))
+
+	var t transport
+	switch name {
+	case "polling":
+		t = newPolling(ctx, &u, c.options, requested)
+	case "websocket":
+		ws, err := dialWebsocket(ctx, &u, c.options, requested)
+		if err != nil {
+			return nil, err
+		}
+		t = ws
+	default:
+		return nil, InvalidError
+	}
+	pack, err := readOpen(ctx, t)
+	if err != nil {
+		t.Close()
+		return nil, err
+	}
+	if pack.typ != OPEN {
+		t.Close()
+		return nil, fmt.Errorf("unexpected %s packet in handshake", pack.typ)
+	}
+
+	var msg struct {
+		Sid          string   `json:"sid"`
+		Upgrades     []string `json:"upgrades"`
+		PingInterval int64    `json:"pingInterval"`
+		PingTimeout  int64    `json:"pingTimeout"`
+		MaxPayload   int      `json:"maxPayload"`
+	}
+	if err := json.NewDecoder(pack).Decode(&msg); err != nil {
+		t.Close()
+		return nil, err
+	}
+	pack.Close()
+
+	c.id = msg.Sid
+	c.pingInterval = time.Duration(msg.PingInterval) * time.Millisecond
+	c.pingTimeout = time.Duration(msg.PingTimeout) * time.Millisecond
+	c.maxPayload = msg.MaxPayload
+	switch t := t.(type) {
+	case *polling:
+		c.protocol = t.Protocol()
+		t.Close()
+		// the following requests carry the sid.
+		q.Set("sid", c.id)
+		q.Set("EIO", strconv.Itoa(c.protocol))
+		u.RawQuery = q.Encode()
+		p := newPolling(c.ctx, &u, c.options, c.protocol)
+		p.setMaxPayload(c.maxPayload)
+		c.setCurrent(p)
+	case *websocketTransport:
+		// the frames look the same, only EIO=4 servers send maxPayload.
+		c.protocol = eio
+		if c.protocol == 0 {
+			c.protocol = 3
+			if msg.MaxPayload > 0 {
+				c.protocol = 4
+			}
+		}
+		t.protocol = c.protocol
+		c.setCurrent(t)
+	}
+	c.options.logger().Info("handshake", "transport", name, "sid", c.id, "protocol", c.protocol, "upgrades", msg.Upgrades,
+		"pingInterval", c.pingInterval, "pingTimeout", c.pingTimeout, "maxPayload", c.maxPayload)
+	c.setState(StateOpen)
+	return msg.Upgrades, nil
+}
+
+// readOpen reads the first packet of t, the read is aborted once ctx is done.
+func readOpen(ctx context.Context, t transport) (*packetReader, error) {
+	type result struct {
+		pack *packetReader
+		err  error
+	}
+	read := make(chan result, 1)
+	go func() {
+		pack, err := t.NextReader()
+		read <- result{pack, err}
+	}()
+	select {
+	case r := <-read:
+		return r.pack, r.err
+	case <-ctx.Done():
+		// the websocket reads do not follow ctx, closing t ends the read.
+		t.Close()
+		<-read
+		return nil, ctx.Err()
+	}
+}
+
+// probe dials the transport name and checks it answers a probe ping. The
+// readLoop then switches to it as soon as the current transport is drained.
+func (c *Conn) probe(name string) {
+	defer c.wg.Done()
+	u := *c.url
+	q := u.Query()
+	q.Set("transport", name)
+	q.Set("EIO", strconv.Itoa(c.protocol))
+	q.Set("sid", c.id)
+	u.RawQuery = q.Encode()
+
+	logger := c.options.logger()
+	logger.Debug("upgrading", "transport", name)
+	t, err := dialWebsocket(c.ctx, &u, c.options, c.protocol)
+	if err != nil {
+		c.upgradeFailed(name, nil, err)
+		return
+	}
+	if !c.setUpgrading(t) {
+		// closed meanwhile.
+		t.Close()
+		return
+	}
+	// the server holds the old transport once probed, let the messages being
+	// written go first, the following ones wait for the upgrade.
+	c.writerLocker.Lock()
+	c.writerLocker.Unlock()
+
+	err = c.writeProbe(t)
+	if err == nil {
+		err = c.readProbe(t)
+	}
+	if err != nil {
+		c.upgradeFailed(name, t, err)
+		return
+	}
+	c.transportLocker.Lock()
+	c.probed = true
+	c.transportLocker.Unlock()
+}
+
+func (c *Conn) writeProbe(t transport) error {
+	w, err := t.NextWriter(MessageText, PING)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, "probe"); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// readProbe waits for the answer to the probe, for pingTimeout at most.
+func (c *Conn) readProbe(t transport) error {
+	answer := make(chan error, 1)
+	go func() {
+		pack, err := t.NextReader()
+		if err != nil {
+			answer <- err
+			return
+		}
+		b, err := ioutil.ReadAll(pack)
+		pack.Close()
+		if err == nil && (pack.typ != PONG || string(b) != "probe") {
+			err = ProbeError
+		}
+		answer <- err
+	}()
+	select {
+	case err := <-answer:
+		return err
+	case <-time.After(c.pingTimeout):
+		t.Close()
+		return ProbeError
+	case <-c.closing:
+		t.Close()
+		return io.EOF
+	}
+}
+
+// upgradeFailed gives the upgrade to t up, the session stays on its transport.
+func (c *Conn) upgradeFailed(name string, t transport, err error) {
+	if t != nil {
+		t.Close()
+		c.setUpgrading(nil)
+	}
+	c.options.logger().Warn("upgrade failed", "transport", name, "err", logError(err))
+	if f := c.options.OnUpgrade; f != nil {
+		f(name, err)
+	}
+}
+
+// takeProbed returns the upgrading transport once it answered the probe and
+// current holds no buffered packet, nil otherwise.
+func (c *Conn) takeProbed(current transport) transport {
+	c.transportLocker.RLock()
+	probed, t := c.probed, c.upgrading
+	c.transportLocker.RUnlock()
+	if !probed {
+		return nil
+	}
+	if p, ok := current.(*polling); ok && p.buffered() {
+		return nil
+	}
+	return t
+}
+
+// upgrade switches to t: the server is told with an upgrade packet, after
+// which nothing is sent over the old transport.
+func (c *Conn) upgrade(t transport) error {
+	c.writerLocker.Lock()
+	w, err := t.NextWriter(MessageText, UPGRADE)
+	if err == nil {
+		err = w.Close()
+	}
+	if err != nil {
+		c.writerLocker.Unlock()
+		c.upgradeFailed(t.Name(), t, err)
+		return err
+	}
+	c.transportLocker.Lock()
+	old := c.current
+	c.current = t
+	c.upgrading = nil
+	c.probed = false
+	c.endUpgrade()
+	c.transportLocker.Unlock()
+	c.writerLocker.Unlock()
+
+	old.Close()
+	c.setState(StateOpen)
+	c.options.logger().Info("upgraded", "transport", t.Name())
+	if f := c.options.OnUpgrade; f != nil {
+		f(t.Name(), nil)
+	}
+	return nil
+}
+
+func (c *Conn) ID() string {
+	return c.id
+}
+
+// Protocol returns the engine.io protocol revision negotiated with the server.
+func (c *Conn) Protocol() int {
+	return c.protocol
+}
+
+// Transport returns the name of the current transport.
+func (c *Conn) Transport() string {
+	return c.getCurrent().Name()
+}
+
+func (c *Conn) State() State {
+	c.stateLocker.RLock()
+	defer c.stateLocker.RUnlock()
+	return c.state
+}
+
+// NextReader returns the next message, it must be closed before the
+// following one can be read. It returns io.EOF once the connection closed.
+func (c *Conn) NextReader() (MessageType, io.ReadCloser, error) {
+	if c.State() == StateClosed {
+		return MessageBinary, nil, io.EOF
+	}
+	ret := <-c.readerChan
+	if ret == nil {
+		return MessageBinary, nil, io.EOF
+	}
+	return ret.msgType, ret, nil
+}
+
+// NextWriter returns a writer of a message of type t, sent on Close. Only
+// one writer is open at once. While upgrading it waits for the upgrade to
+// be over, for pingTimeout at most.
+func (c *Conn) NextWriter(t MessageType) (io.WriteCloser, error) {
+	switch c.State() {
+	case StateUpgrading:
+		// servers may hold what is posted on the old transport meanwhile.
+		if done := c.getUpgradeDone(); done != nil {
+			select {
+			case <-done:
+			case <-time.After(c.pingTimeout):
+			}
+		}
+		if s := c.State(); s == StateUpgrading {
+			return nil, fmt.Errorf("upgrading")
+		} else if s != StateOpen {
+			return nil, io.EOF
+		}
+	case StateOpen:
+	default:
+		return nil, io.EOF
+	}
+	c.writerLocker.Lock()
+	w, err := c.getCurrent().NextWriter(t, MESSAGE)
+	if err != nil {
+		c.writerLocker.Unlock()
+		return nil, err
+	}
+	return newConnWriter(w, &c.writerLocker), nil
+}
+
+// Close closes the session, the server is sent a close packet.
+func (c *Conn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closing)
+	})
+	defer c.cancel()
+	if s := c.State(); s != StateOpen && s != StateUpgrading {
+		return nil
+	}
+	// before the close packet, the readLoop closes the connection once the
+	// server answers it.
+	c.setState(StateClosing)
+	if t := c.getUpgrading(); t != nil {
+		t.Close()
+	}
+	c.writerLocker.Lock()
+	if w, err := c.getCurrent().NextWriter(MessageText, CLOSE); err == nil {
+		w.Close()
+	}
+	c.writerLocker.Unlock()
+	return c.getCurrent().Close()
+}
+
+// Err returns why the connection closed, nil when it was closed by Close.
+func (c *Conn) Err() error {
+	c.stateLocker.RLock()
+	defer c.stateLocker.RUnlock()
+	return c.err
+}
+
+// Wait blocks until the goroutines of the connection returned.
+func (c *Conn) Wait() {
+	c.wg.Wait()
+}
+
+// onPacket handles p, it returns false when p is a message whose reader was
+// given up by Close before being closed.
+func (c *Conn) onPacket(p *packetReader) bool {
+	switch p.typ {
+	case CLOSE:
+		if !c.isClosing() {
+			// the server closed the session, not the answer to Close.
+			c.setErr(io.EOF)
+		}
+		c.getCurrent().Close()
+	case PING:
+		c.writerLocker.Lock()
+		if w, _ := c.getCurrent().NextWriter(MessageText, PONG); w != nil {
+			io.Copy(w, p)
+			w.Close()
+		}
+		c.writerLocker.Unlock()
+		fallthrough
+	case PONG:
+		select {
+		case c.pingChan <- true:
+		case <-c.closing:
+		}
+	case MESSAGE:
+		// buffered, the reader can be closed after the connection gave it up.
+		closeChan := make(chan struct{}, 1)
+		select {
+		case c.readerChan <- newConnReader(p, closeChan):
+		case <-c.closing:
+			// nobody reads the connection any longer.
+			return true
+		}
+		select {
+		case <-closeChan:
+		case <-c.closing:
+			// the reader is stuck, a ping timeout or Close gives it up.
+			return false
+		}
+	}
+	return true
+}
+
+// readLoop reads the packets of the current transport and switches to the
+// upgrading one once it is probed.
+func (c *Conn) readLoop() {
+	defer func() {
+		c.onClose()
+		c.wg.Done()
+	}()
+
+	for {
+		current := c.getCurrent()
+		if t := c.takeProbed(current); t != nil {
+			if c.upgrade(t) == nil {
+				current = t
+			}
+		}
+
+		pack, err := current.NextReader()
+		if err != nil {
+			if current != c.getCurrent() {
+				// the transport was replaced by an upgrade.
+				continue
+			}
+			select {
+			case <-c.closing:
+			default:
+				c.setErr(err)
+			}
+			return
+		}
+		if !c.onPacket(pack) {
+			// the reader may still be read, reading the transport again would
+			// race with it. Close closes the transport, then cancels ctx.
+			<-c.ctx.Done()
+			return
+		}
+		pack.Close()
+	}
+}
+
+func (c *Conn) onClose() {
+	c.getCurrent().Close()
+	c.setState(StateClosed)
+	if t := c.getUpgrading(); t != nil {
+		t.Close()
+		c.setUpgrading(nil)
+	}
+	close(c.readerChan)
+	close(c.pingChan)
+}
+
+func (c *Conn) getCurrent() transport {
+	c.transportLocker.RLock()
+	defer c.transportLocker.RUnlock()
+	return c.current
+}
+
+func (c *Conn) setCurrent(t transport) {
+	c.transportLocker.Lock()
+	defer c.transportLocker.Unlock()
+	c.current = t
+}
+
+func (c *Conn) getUpgrading() transport {
+	c.transportLocker.RLock()
+	defer c.transportLocker.RUnlock()
+	return c.upgrading
+}
+
+// setUpgrading starts upgrading to t, or gives the upgrade up when t is nil.
+// It fails once the connection is closing.
+func (c *Conn) setUpgrading(t transport) bool {
+	c.transportLocker.Lock()
+	if t != nil && c.isClosing() {
+		c.transportLocker.Unlock()
+		return false
+	}
+	c.upgrading = t
+	c.probed = false
+	if t != nil {
+		c.upgradeDone = make(chan struct{})
+	} else {
+		c.endUpgrade()
+	}
+	c.transportLocker.Unlock()
+
+	switch s := c.State(); {
+	case t != nil && s == StateOpen:
+		c.setState(StateUpgrading)
+	case t == nil && s == StateUpgrading:
+		c.setState(StateOpen)
+	}
+	return true
+}
+
+func (c *Conn) getUpgradeDone() chan struct{} {
+	c.transportLocker.RLock()
+	defer c.transportLocker.RUnlock()
+	return c.upgradeDone
+}
+
+// endUpgrade releases the writers waiting for the upgrade, it must be called
+// with transportLocker held.
+func (c *Conn) endUpgrade() {
+	if c.upgradeDone != nil {
+		close(c.upgradeDone)
+		c.upgradeDone = nil
+	}
+}
+
+func (c *Conn) isClosing() bool {
+	select {
+	case <-c.closing:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *Conn) setState(state State) {
+	c.stateLocker.Lock()
+	changed := c.state != state
+	c.state = state
+	c.stateLocker.Unlock()
+	if changed && c.options.OnStateChange != nil {
+		c.options.OnStateChange(state)
+	}
+}
+
+// setErr records why the connection closed, the first reason wins.
+func (c *Conn) setErr(err error) {
+	c.stateLocker.Lock()
+	defer c.stateLocker.Unlock()
+	if c.err == nil {
+		c.err = err
+	}
+}
@@ -0,0 +1,407 @@
+package engineio
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func dialTestServer(t *testing.T, s *testServer, opts *Options) *Conn {
+	t.Helper()
+	u, err := url.Parse(s.URL + "/engine.io/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := Dial(u, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		c.Close()
+		c.Wait()
+	})
+	return c
+}
+
+// readMessage reads the next message of c, failing after a second.
+func readMessage(t *testing.T, c *Conn) testPacket {
+	t.Helper()
+	type result struct {
+		p   testPacket
+		err error
+	}
+	ret := make(chan result, 1)
+	go func() {
+		msgType, r, err := c.NextReader()
+		if err != nil {
+			ret <- result{err: err}
+			return
+		}
+		b, err := ioutil.ReadAll(r)
+		r.Close()
+		ret <- result{testPacket{MESSAGE, msgType, string(b)}, err}
+	}()
+	select {
+	case r := <-ret:
+		if r.err != nil {
+			t.Fatal(r.err)
+		}
+		return r.p
+	case <-time.After(time.Second):
+		t.Fatal("timed out reading a message")
+	}
+	return testPacket{}
+}
+
+func writeMessage(t *testing.T, c *Conn, p testPacket) {
+	t.Helper()
+	w, err := c.NextWriter(p.msgType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(w, p.data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// exchange checks text and binary messages go both ways.
+func exchange(t *testing.T, s *testServer, c *Conn, received chan testPacket) {
+	t.Helper()
+	messages := []testPacket{
+		{MESSAGE, MessageText, "hello é€😀"},
+		{MESSAGE, MessageBinary, "\x00\x01\xff\x1e"},
+	}
+	for _, m := range messages {
+		writeMessage(t, c, m)
+		select {
+		case got := <-received:
+			if got != m {
+				t.Fatalf("server received %v, want %v", got, m)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("server did not receive %v", m)
+		}
+	}
+	sess := s.Session(t)
+	for _, m := range messages {
+		sess.Send(m)
+	}
+	for _, m := range messages {
+		if got := readMessage(t, c); got != m {
+			t.Fatalf("client received %v, want %v", got, m)
+		}
+	}
+}
+
+// A reader given up by Close may still be read meanwhile, the readLoop must
+// not read the transport again.
+func TestCloseWhileReading(t *testing.T) {
+	s := newTestServer(t)
+	s.Start()
+	c := dialTestServer(t, s, &Options{Transports: []string{"websocket"}})
+	sess := s.Session(t)
+	m := testPacket{MESSAGE, MessageText, strings.Repeat("a", 1<<16)}
+	sess.Send(m)
+	sess.Send(m)
+	_, r, err := c.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := make(chan error, 1)
+	go func() { closed <- c.Close() }()
+	ioutil.ReadAll(r)
+	r.Close()
+	if err := <-closed; err != nil {
+		t.Fatal(err)
+	}
+	c.Wait()
+}
+
+func receiveMessages(s *testServer) chan testPacket {
+	received := make(chan testPacket, 16)
+	s.OnMessage = func(_ *testSession, m testPacket) {
+		received <- m
+	}
+	return received
+}
+
+func TestDial(t *testing.T) {
+	for _, transport := range []string{"polling", "websocket"} {
+		for _, eio := range []int{3, 4} {
+			t.Run(transport+"/EIO="+string(rune('0'+eio)), func(t *testing.T) {
+				s := newTestServer(t)
+				received := receiveMessages(s)
+				s.Start()
+				var states []State
+				var mu sync.Mutex
+				c := dialTestServer(t, s, &Options{
+					Transports: []string{transport},
+					EIO:        eio,
+					OnStateChange: func(state State) {
+						mu.Lock()
+						defer mu.Unlock()
+						states = append(states, state)
+					},
+				})
+				if c.Protocol() != eio || c.Transport() != transport || c.ID() != "sid1" || c.State() != StateOpen {
+					t.Fatalf("dialed EIO=%d over %s with sid %q in state %v", c.Protocol(), c.Transport(), c.ID(), c.State())
+				}
+				exchange(t, s, c, received)
+
+				if err := c.Close(); err != nil {
+					t.Fatal(err)
+				}
+				c.Wait()
+				if _, _, err := c.NextReader(); err != io.EOF {
+					t.Fatalf("NextReader after Close = %v, want EOF", err)
+				}
+				if c.Err() != nil {
+					t.Fatalf("Err after Close = %v", c.Err())
+				}
+				select {
+				case <-s.Session(t).closed:
+				case <-time.After(time.Second):
+					t.Fatal("the server was not sent a close packet")
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				if len(states) == 0 || states[0] != StateOpen || states[len(states)-1] != StateClosed {
+					t.Fatalf("states = %v", states)
+				}
+			})
+		}
+	}
+}
+
+func TestDialFollowsServerProtocol(t *testing.T) {
+	for _, transport := range []string{"polling", "websocket"} {
+		for _, eio := range []int{3, 4} {
+			s := newTestServer(t)
+			s.Protocol = eio
+			received := receiveMessages(s)
+			s.Start()
+			c := dialTestServer(t, s, &Options{Transports: []string{transport}})
+			if c.Protocol() != eio {
+				t.Fatalf("%s: Protocol() = %d, want %d", transport, c.Protocol(), eio)
+			}
+			exchange(t, s, c, received)
+		}
+	}
+}
+
+func TestDialFallback(t *testing.T) {
+	s := startTestServer(t)
+	u, _ := url.Parse(s.URL)
+	if _, err := Dial(u, &Options{Transports: []string{"carrier-pigeon"}}); err != InvalidError {
+		t.Fatalf("err = %v, want InvalidError", err)
+	}
+	u.Scheme = "ftp"
+	if _, err := Dial(u, &Options{Transports: []string{"websocket", "polling"}}); err == nil {
+		t.Fatal("dialed an ftp url")
+	}
+
+	// the websocket handshake fails on a path the server does not upgrade.
+	s.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("transport") == "websocket" {
+			http.Error(w, "no websocket", http.StatusBadRequest)
+			return
+		}
+		s.ServeHTTP(w, r)
+	})
+	c := dialTestServer(t, s, &Options{Transports: []string{"websocket", "polling"}})
+	if c.Transport() != "polling" {
+		t.Fatalf("Transport() = %s, want the polling fallback", c.Transport())
+	}
+}
+
+func TestUpgrade(t *testing.T) {
+	for _, eio := range []int{3, 4} {
+		t.Run("EIO="+string(rune('0'+eio)), func(t *testing.T) {
+			s := newTestServer(t)
+			s.Upgrades = []string{"websocket"}
+			received := receiveMessages(s)
+			s.Start()
+			upgraded := make(chan error, 1)
+			c := dialTestServer(t, s, &Options{
+				EIO: eio,
+				OnUpgrade: func(transport string, err error) {
+					upgraded <- err
+				},
+			})
+			select {
+			case err := <-upgraded:
+				if err != nil {
+					t.Fatal(err)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("not upgraded")
+			}
+			if c.Transport() != "websocket" || c.State() != StateOpen {
+				t.Fatalf("%s in state %v after the upgrade", c.Transport(), c.State())
+			}
+			sess := s.Session(t)
+			deadline := time.Now().Add(time.Second)
+			for {
+				sess.mu.Lock()
+				ok := sess.upgraded
+				sess.mu.Unlock()
+				if ok {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatal("the server was not sent the upgrade packet")
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+			exchange(t, s, c, received)
+		})
+	}
+}
+
+func TestUpgradeFailed(t *testing.T) {
+	s := newTestServer(t)
+	s.Upgrades = []string{"websocket"}
+	received := receiveMessages(s)
+	s.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("transport") == "websocket" {
+			http.Error(w, "no websocket", http.StatusBadRequest)
+			return
+		}
+		s.ServeHTTP(w, r)
+	})
+	s.Start()
+	upgraded := make(chan error, 1)
+	c := dialTestServer(t, s, &Options{
+		OnUpgrade: func(transport string, err error) {
+			upgraded <- err
+		},
+	})
+	select {
+	case err := <-upgraded:
+		if err == nil {
+			t.Fatal("upgraded through a failed websocket handshake")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("the upgrade did not fail")
+	}
+	if c.Transport() != "polling" || c.State() != StateOpen {
+		t.Fatalf("%s in state %v after a failed upgrade", c.Transport(), c.State())
+	}
+	exchange(t, s, c, received)
+}
+
+func TestHeartbeat(t *testing.T) {
+	for _, eio := range []int{3, 4} {
+		t.Run("EIO="+string(rune('0'+eio)), func(t *testing.T) {
+			s := startTestServer(t)
+			roundTrips := make(chan time.Duration, 16)
+			c := dialTestServer(t, s, &Options{
+				Transports: []string{"websocket"},
+				EIO:        eio,
+				OnPingRoundTrip: func(d time.Duration) {
+					select {
+					case roundTrips <- d:
+					default:
+					}
+				},
+			})
+			// several ping intervals, pingInterval+pingTimeout included.
+			time.Sleep(3 * (s.PingInterval + s.PingTimeout))
+			if c.State() != StateOpen || c.Err() != nil {
+				t.Fatalf("state %v, err %v while the server keeps the heartbeat", c.State(), c.Err())
+			}
+			if eio == 3 && len(roundTrips) < 2 {
+				t.Fatalf("%d ping round trips measured", len(roundTrips))
+			}
+			if eio == 4 && len(roundTrips) != 0 {
+				t.Fatal("ping round trips measured while the server sends the pings")
+			}
+		})
+	}
+}
+
+func TestPingTimeout(t *testing.T) {
+	for _, transport := range []string{"polling", "websocket"} {
+		for _, eio := range []int{3, 4} {
+			t.Run(transport+"/EIO="+string(rune('0'+eio)), func(t *testing.T) {
+				s := newTestServer(t)
+				s.Silent = true
+				s.Start()
+				c := dialTestServer(t, s, &Options{Transports: []string{transport}, EIO: eio})
+				done := make(chan error, 1)
+				go func() {
+					_, _, err := c.NextReader()
+					done <- err
+				}()
+				select {
+				case err := <-done:
+					if err != io.EOF {
+						t.Fatalf("NextReader = %v, want EOF", err)
+					}
+				case <-time.After(2 * time.Second):
+					t.Fatal("no ping timeout")
+				}
+				if c.Err() != PingTimeoutError {
+					t.Fatalf("Err() = %v, want PingTimeoutError", c.Err())
+				}
+			})
+		}
+	}
+}
+
+func TestServerClose(t *testing.T) {
+	for _, transport := range []string{"polling", "websocket"} {
+		s := startTestServer(t)
+		c := dialTestServer(t, s, &Options{Transports: []string{transport}})
+		s.Session(t).close()
+		if _, _, err := c.NextReader(); err != io.EOF {
+			t.Fatalf("%s: NextReader = %v, want EOF", transport, err)
+		}
+		if c.Err() == nil {
+			t.Fatalf("%s: no error once the server closed the session", transport)
+		}
+	}
+}
+
+func TestMaxMessageSize(t *testing.T) {
+	for _, transport := range []string{"polling", "websocket"} {
+		for _, eio := range []int{3, 4} {
+			t.Run(transport+"/EIO="+string(rune('0'+eio)), func(t *testing.T) {
+				s := startTestServer(t)
+				c := dialTestServer(t, s, &Options{Transports: []string{transport}, EIO: eio, MaxMessageSize: 8})
+				sess := s.Session(t)
+				// raised to minMessageSize.
+				at := testPacket{MESSAGE, MessageBinary, strings.Repeat("b", minMessageSize)}
+				sess.Send(at)
+				if got := readMessage(t, c); got != at {
+					t.Fatalf("received %v, want %v", got, at)
+				}
+				sess.Send(testPacket{MESSAGE, MessageText, strings.Repeat("a", 64<<10)})
+				done := make(chan error, 1)
+				go func() {
+					_, _, err := c.NextReader()
+					done <- err
+				}()
+				select {
+				case err := <-done:
+					if err != io.EOF {
+						t.Fatalf("NextReader = %v, want EOF", err)
+					}
+				case <-time.After(2 * time.Second):
+					t.Fatal("the connection did not close")
+				}
+				if c.Err() != MessageTooLargeError {
+					t.Fatalf("Err() = %v, want MessageTooLargeError", c.Err())
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package engineio
+
+import (
+	"io"
+	"sync"
+)
+
+// connReader is a message handed to the reader of a Conn, the readLoop waits
+// for its Close before reading the next packet.
+type connReader struct {
+	*packetReader
+	closeChan chan struct{}
+}
+
+func newConnReader(p *packetReader, closeChan chan struct{}) *connReader {
+	return &connReader{
+		packetReader: p,
+		closeChan:    closeChan,
+	}
+}
+
+func (r *connReader) Close() error {
+	if r.closeChan == nil {
+		return nil
+	}
+	r.closeChan <- struct{}{}
+	r.closeChan = nil
+	return nil
+}
+
+// connWriter releases the writer lock of the Conn on Close.
+type connWriter struct {
+	io.WriteCloser
+	locker *sync.Mutex
+}
+
+func newConnWriter(w io.WriteCloser, locker *sync.Mutex) *connWriter {
+	return &connWriter{
+		WriteCloser: w,
+		locker:      locker,
+	}
+}
+
+func (w *connWriter) Close() error {
+	defer func() {
+		if w.locker != nil {
+			w.locker.Unlock()
+			w.locker = nil
+		}
+	}()
+	return w.WriteCloser.Close()
+}
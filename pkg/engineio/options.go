@@ -0,0 +1,128 @@
+package engineio
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Logger receives the logs of the connection, args are alternating keys and values.
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+type Options struct {
+	// Transports lists the transports to open the session with, in order,
+	// "polling" or "websocket". The session is then upgraded to the following
+	// ones the server offers. It defaults to polling upgraded to websocket.
+	Transports []string
+	EIO        int // protocol revision, 3 or 4, 0 asks for 4 and follows the server
+	Header     http.Header
+
+	HTTPClient       *http.Client      // sends the polling requests, http.DefaultClient when nil
+	Dialer           *websocket.Dialer // dials the websocket transport, websocket.DefaultDialer when nil
+	RequestDecorator func(ctx context.Context, r *http.Request) error
+
+	// MaxMessageSize bounds the messages received in bytes, 0 means unlimited.
+	// The websocket frames and the polling packets are cut there, a larger
+	// message closes the connection with MessageTooLargeError. It is raised
+	// to minMessageSize, for the handshake to fit.
+	MaxMessageSize int64
+
+	Logger          Logger
+	OnStateChange   func(state State)
+	OnUpgrade       func(transport string, err error) // called once per upgrade attempt
+	OnPingRoundTrip func(d time.Duration)             // only with EIO=3, where the client sends the pings
+}
+
+func (opts *Options) transports() []string {
+	if len(opts.Transports) == 0 {
+		return []string{"polling", "websocket"}
+	}
+	return opts.Transports
+}
+
+func (opts *Options) httpClient() *http.Client {
+	if opts.HTTPClient == nil {
+		return http.DefaultClient
+	}
+	return opts.HTTPClient
+}
+
+func (opts *Options) dialer() *websocket.Dialer {
+	if opts.Dialer == nil {
+		return websocket.DefaultDialer
+	}
+	return opts.Dialer
+}
+
+// minMessageSize is the lowest MaxMessageSize, the open packet is far shorter.
+const minMessageSize = 1 << 10
+
+func (opts *Options) maxMessageSize() int64 {
+	if opts.MaxMessageSize > 0 && opts.MaxMessageSize < minMessageSize {
+		return minMessageSize
+	}
+	return opts.MaxMessageSize
+}
+
+func (opts *Options) logger() Logger {
+	if opts.Logger == nil {
+		return nopLogger{}
+	}
+	return opts.Logger
+}
+
+// logError returns err to log: the errors of the http client hold the request
+// url, its query and password are dropped as they may carry credentials.
+func logError(err error) error {
+	var ue *url.Error
+	if !errors.As(err, &ue) {
+		return err
+	}
+	u, perr := url.Parse(ue.URL)
+	if perr != nil {
+		return ue.Err
+	}
+	u.User = nil
+	u.RawQuery = ""
+	return errors.New(strings.ReplaceAll(err.Error(), ue.URL, u.String()))
+}
+
+func (opts *Options) decorate(r *http.Request) error {
+	if opts.RequestDecorator == nil {
+		return nil
+	}
+	return opts.RequestDecorator(r.Context(), r)
+}
+
+// newRequest returns a request to u with a copy of the header of the
+// options, passed through the RequestDecorator.
+func newRequest(ctx context.Context, method string, u *url.URL, opts *Options) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Header != nil {
+		req.Header = opts.Header.Clone()
+	}
+	if err := opts.decorate(req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Debug(string, ...interface{}) {}
+func (nopLogger) Info(string, ...interface{})  {}
+func (nopLogger) Warn(string, ...interface{})  {}
+func (nopLogger) Error(string, ...interface{}) {}
@@ -0,0 +1,106 @@
+// Package engineio implements the client side of the engine.io protocol,
+// revisions 3 and 4, over the polling and websocket transports.
+package engineio
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// PacketType is the type of an engine.io packet.
+type PacketType byte
+
+const (
+	OPEN PacketType = iota
+	CLOSE
+	PING
+	PONG
+	MESSAGE
+	UPGRADE
+	NOOP
+)
+
+func (t PacketType) String() string {
+	switch t {
+	case OPEN:
+		return "open"
+	case CLOSE:
+		return "close"
+	case PING:
+		return "ping"
+	case PONG:
+		return "pong"
+	case MESSAGE:
+		return "message"
+	case UPGRADE:
+		return "upgrade"
+	case NOOP:
+		return "noop"
+	}
+	return fmt.Sprintf("unknown(%d)", byte(t))
+}
+
+// MessageType tells whether a message is text or binary.
+type MessageType int
+
+const (
+	MessageText MessageType = iota
+	MessageBinary
+)
+
+var InvalidPacketError = errors.New("invalid packet")
+
+// packetReader is a packet read from a transport, its data is read from the
+// embedded reader. The transports drop what is left of a packet when reading
+// the next one, so Close has nothing to release.
+type packetReader struct {
+	io.Reader
+	typ     PacketType
+	msgType MessageType
+}
+
+func (r *packetReader) Close() error {
+	return nil
+}
+
+// readPacket reads the header of a packet encoded as text, "<type><data>" or
+// "b<type><base64 data>", or as binary, "<type byte><data>".
+func readPacket(r io.Reader) (*packetReader, error) {
+	b := []byte{0}
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	msgType := MessageText
+	if b[0] == 'b' {
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		r = base64.NewDecoder(base64.StdEncoding, r)
+		msgType = MessageBinary
+	}
+	if b[0] >= '0' {
+		b[0] -= '0'
+	} else {
+		msgType = MessageBinary
+	}
+	t := PacketType(b[0])
+	if t > NOOP {
+		return nil, InvalidPacketError
+	}
+	return &packetReader{
+		Reader:  r,
+		typ:     t,
+		msgType: msgType,
+	}, nil
+}
+
+// newPacketReader returns a packet whose type and message type are already known.
+func newPacketReader(r io.Reader, t PacketType, msgType MessageType) *packetReader {
+	return &packetReader{
+		Reader:  r,
+		typ:     t,
+		msgType: msgType,
+	}
+}
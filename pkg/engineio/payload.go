@@ -0,0 +1,219 @@
+package engineio
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"io"
+	"math"
+	"strconv"
+	"unicode/utf8"
+)
+
+// recordSeparator separates the packets of an EIO=4 polling payload.
+const recordSeparator = 0x1e
+
+// payloadDecoder returns the packets of a polling payload one at a time.
+type payloadDecoder interface {
+	Next() (*packetReader, error)
+}
+
+// newPayloadDecoder returns the decoder of a payload of the protocol revision.
+// The packets longer than max, when positive, fail with MessageTooLargeError.
+func newPayloadDecoder(r *bufio.Reader, protocol int, max int) payloadDecoder {
+	if protocol >= 4 {
+		return &separatedPayloadDecoder{r: r, max: max}
+	}
+	return &lengthPayloadDecoder{r: r, max: max}
+}
+
+// encodedLimit returns the length of the longest packet holding a message
+// of max bytes: its type followed by the data in base64.
+func encodedLimit(max int64) int {
+	if max > math.MaxInt32 {
+		return math.MaxInt32
+	}
+	return 1 + base64.StdEncoding.EncodedLen(int(max))
+}
+
+// lengthPayloadDecoder reads the EIO=3 polling payload, where each packet is
+// prefixed by its length: "<length>:<packet>" in the text format, where the
+// length counts UTF-16 code units, or "<0|1><length digits>\xff<packet>" in
+// the binary one, where the length counts bytes.
+type lengthPayloadDecoder struct {
+	r   *bufio.Reader
+	max int
+}
+
+func (d *lengthPayloadDecoder) Next() (*packetReader, error) {
+	first, err := d.r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	if first[0] >= '0' {
+		return d.nextText()
+	}
+	return d.nextBinary()
+}
+
+func (d *lengthPayloadDecoder) nextText() (*packetReader, error) {
+	l, err := d.readLength(':')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(string(l))
+	if err != nil || n <= 0 {
+		return nil, InvalidPacketError
+	}
+	if d.max > 0 && n > d.max {
+		return nil, MessageTooLargeError
+	}
+	var b []byte
+	for units := 0; units < n; {
+		r, size, err := d.r.ReadRune()
+		if err != nil {
+			return nil, InvalidPacketError
+		}
+		if r == utf8.RuneError && size == 1 {
+			return nil, InvalidPacketError
+		}
+		b = utf8.AppendRune(b, r)
+		units++
+		if r >= 0x10000 {
+			// encoded as a surrogate pair in JavaScript.
+			units++
+		}
+	}
+	return readPacket(bytes.NewReader(b))
+}
+
+// readLength reads the digits of a packet length up to delim, which is dropped.
+// The lengths of more than 10 digits do not fit the packets.
+func (d *lengthPayloadDecoder) readLength(delim byte) ([]byte, error) {
+	var digits []byte
+	for len(digits) <= 10 {
+		c, err := d.r.ReadByte()
+		if err != nil {
+			return nil, InvalidPacketError
+		}
+		if c == delim {
+			if len(digits) == 0 {
+				return nil, InvalidPacketError
+			}
+			return digits, nil
+		}
+		digits = append(digits, c)
+	}
+	return nil, InvalidPacketError
+}
+
+func (d *lengthPayloadDecoder) nextBinary() (*packetReader, error) {
+	kind, err := d.r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	digits, err := d.readLength(0xff)
+	if err != nil {
+		return nil, err
+	}
+	n := 0
+	for _, digit := range digits {
+		if digit > 9 || n > (math.MaxInt32-9)/10 {
+			return nil, InvalidPacketError
+		}
+		n = n*10 + int(digit)
+	}
+	if d.max > 0 && n > d.max {
+		return nil, MessageTooLargeError
+	}
+	// the buffer grows with the bytes actually read, not with the length announced.
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, d.r, int64(n)); err != nil {
+		return nil, InvalidPacketError
+	}
+	b := buf.Bytes()
+	if kind == 1 {
+		if n == 0 {
+			return nil, InvalidPacketError
+		}
+		return newPacketReader(bytes.NewReader(b[1:]), PacketType(b[0]), MessageBinary), nil
+	}
+	return readPacket(bytes.NewReader(b))
+}
+
+// separatedPayloadDecoder reads the EIO=4 polling payload, where packets are
+// separated by a record separator and binary ones are sent as "b" followed by base64.
+type separatedPayloadDecoder struct {
+	r   *bufio.Reader
+	max int
+}
+
+func (d *separatedPayloadDecoder) Next() (*packetReader, error) {
+	b, err := d.readRecord()
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if err == io.EOF && len(b) == 0 {
+		return nil, io.EOF
+	}
+	if len(b) == 0 {
+		return nil, InvalidPacketError
+	}
+	if b[0] == 'b' {
+		// binary packets are always messages.
+		data := base64.NewDecoder(base64.StdEncoding, bytes.NewReader(b[1:]))
+		return newPacketReader(data, MESSAGE, MessageBinary), nil
+	}
+	return readPacket(bytes.NewReader(b))
+}
+
+// readRecord reads the next packet without its separator, failing with
+// MessageTooLargeError as soon as it is longer than max.
+func (d *separatedPayloadDecoder) readRecord() ([]byte, error) {
+	var b []byte
+	for {
+		frag, err := d.r.ReadSlice(recordSeparator)
+		if d.max > 0 && len(b)+len(frag) > d.max+1 {
+			return nil, MessageTooLargeError
+		}
+		b = append(b, frag...)
+		switch err {
+		case bufio.ErrBufferFull:
+			continue
+		case nil:
+			return b[:len(b)-1], nil
+		default:
+			if d.max > 0 && len(b) > d.max {
+				return nil, MessageTooLargeError
+			}
+			return b, err
+		}
+	}
+}
+
+// encodePayload returns the polling payload of a single packet in the protocol
+// revision: the binary format of EIO=3, or the text one of EIO=4.
+func encodePayload(protocol int, msgType MessageType, t PacketType, data []byte) []byte {
+	if protocol < 4 {
+		kind, typ := byte(0), byte(t)+'0'
+		if msgType == MessageBinary {
+			kind, typ = 1, byte(t)
+		}
+		buf := bytes.NewBuffer(nil)
+		buf.WriteByte(kind)
+		for _, digit := range strconv.Itoa(len(data) + 1) {
+			buf.WriteByte(byte(digit - '0'))
+		}
+		buf.WriteByte(0xff)
+		buf.WriteByte(typ)
+		buf.Write(data)
+		return buf.Bytes()
+	}
+	if msgType == MessageBinary {
+		ret := make([]byte, 1+base64.StdEncoding.EncodedLen(len(data)))
+		ret[0] = 'b'
+		base64.StdEncoding.Encode(ret[1:], data)
+		return ret
+	}
+	return append([]byte{byte(t) + '0'}, data...)
+}
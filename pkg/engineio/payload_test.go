@@ -0,0 +1,184 @@
+package engineio
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testPacket struct {
+	typ     PacketType
+	msgType MessageType
+	data    string
+}
+
+// decodePayload returns the packets of payload, up to the first error.
+func decodePayload(payload string, protocol int, max int) ([]testPacket, error) {
+	d := newPayloadDecoder(bufio.NewReader(strings.NewReader(payload)), protocol, max)
+	var ret []testPacket
+	for {
+		p, err := d.Next()
+		if err == io.EOF {
+			return ret, nil
+		}
+		if err != nil {
+			return ret, err
+		}
+		b, err := ioutil.ReadAll(p)
+		if err != nil {
+			return ret, err
+		}
+		ret = append(ret, testPacket{p.typ, p.msgType, string(b)})
+	}
+}
+
+func TestDecodePayload(t *testing.T) {
+	tests := []struct {
+		name     string
+		protocol int
+		payload  string
+		want     []testPacket
+	}{
+		{"eio3 text", 3, "6:4hello2:4a1:2", []testPacket{
+			{MESSAGE, MessageText, "hello"},
+			{MESSAGE, MessageText, "a"},
+			{PING, MessageText, ""},
+		}},
+		{"eio3 text counts utf-16 units", 3, "3:4é€3:4😀", []testPacket{
+			{MESSAGE, MessageText, "é€"},
+			{MESSAGE, MessageText, "😀"},
+		}},
+		{"eio3 text base64", 3, "6:b4AQID", []testPacket{
+			{MESSAGE, MessageBinary, "\x01\x02\x03"},
+		}},
+		{"eio3 binary", 3, "\x00\x06\xff4hello\x01\x04\xff\x04\x01\x02\x03\x00\x01\x00\xff" + strings.Repeat("4", 10), []testPacket{
+			{MESSAGE, MessageText, "hello"},
+			{MESSAGE, MessageBinary, "\x01\x02\x03"},
+			{MESSAGE, MessageText, strings.Repeat("4", 9)},
+		}},
+		{"eio4", 4, "4hello\x1e4a\x1ebAQID\x1e2\x1e6", []testPacket{
+			{MESSAGE, MessageText, "hello"},
+			{MESSAGE, MessageText, "a"},
+			{MESSAGE, MessageBinary, "\x01\x02\x03"},
+			{PING, MessageText, ""},
+			{NOOP, MessageText, ""},
+		}},
+		{"eio4 separator in the last packet", 4, "4a\x1e", []testPacket{
+			{MESSAGE, MessageText, "a"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodePayload(tt.payload, tt.protocol, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeInvalidPayload(t *testing.T) {
+	tests := []struct {
+		name     string
+		protocol int
+		max      int
+		payload  string
+	}{
+		{"eio3 zero length", 3, 0, "0:"},
+		{"eio3 negative length", 3, 0, "-1:4"},
+		{"eio3 length not a number", 3, 0, "x:4"},
+		{"eio3 length overflow", 3, 0, "99999999999999999999999999:4"},
+		{"eio3 length without separator", 3, 0, "6"},
+		{"eio3 truncated", 3, 0, "10:4abc"},
+		{"eio3 invalid utf-8", 3, 0, "2:4\xff"},
+		{"eio3 binary digit", 3, 0, "\x00\x0a\xff4"},
+		{"eio3 binary without length", 3, 0, "\x00\xff4"},
+		{"eio3 binary without separator", 3, 0, "\x00\x01"},
+		{"eio3 binary length overflow", 3, 0, "\x00" + strings.Repeat("\x09", 25) + "\xff4"},
+		{"eio3 binary truncated", 3, 0, "\x00\x09\xff4abc"},
+		{"eio3 binary empty", 3, 0, "\x01\x00\xff"},
+		{"eio3 invalid type", 3, 0, "1:9"},
+		{"eio4 empty packet", 4, 0, "4a\x1e\x1e4b"},
+		{"eio4 invalid type", 4, 0, "9"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decodePayload(tt.payload, tt.protocol, tt.max)
+			if err != InvalidPacketError {
+				t.Fatalf("err = %v, want InvalidPacketError", err)
+			}
+		})
+	}
+}
+
+func TestDecodePayloadLimit(t *testing.T) {
+	tests := []struct {
+		name     string
+		protocol int
+		payload  string
+		ok       bool
+	}{
+		{"eio3 text at max", 3, "6:4hello", true},
+		{"eio3 text over max", 3, "7:4hello!", false},
+		{"eio3 text length over max", 3, "99999:4hello", false},
+		{"eio3 binary at max", 3, "\x00\x06\xff4hello", true},
+		{"eio3 binary over max", 3, "\x00\x07\xff4hello!", false},
+		{"eio4 at max", 4, "4hello\x1e4a", true},
+		{"eio4 over max", 4, "4a\x1e4hello!", false},
+		{"eio4 last over max", 4, "4hello!", false},
+		{"eio4 over the read buffer", 4, "4" + strings.Repeat("a", 8192), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decodePayload(tt.payload, tt.protocol, 6)
+			if tt.ok && err != nil {
+				t.Fatal(err)
+			}
+			if !tt.ok && err != MessageTooLargeError {
+				t.Fatalf("err = %v, want MessageTooLargeError", err)
+			}
+		})
+	}
+
+	// a long packet is read in several slices of the reader buffer.
+	long := "4" + strings.Repeat("a", 10000)
+	got, err := decodePayload(long+"\x1e"+long, 4, len(long))
+	if err != nil || len(got) != 2 || got[1].data != long[1:] {
+		t.Fatalf("decoded %d packets, %v", len(got), err)
+	}
+}
+
+func TestEncodePayload(t *testing.T) {
+	tests := []struct {
+		protocol int
+		packet   testPacket
+		want     string
+	}{
+		{3, testPacket{MESSAGE, MessageText, "hello"}, "\x00\x06\xff4hello"},
+		{3, testPacket{MESSAGE, MessageBinary, "\x01\x02\x03"}, "\x01\x04\xff\x04\x01\x02\x03"},
+		{3, testPacket{PING, MessageText, "probe"}, "\x00\x06\xff2probe"},
+		{3, testPacket{MESSAGE, MessageText, strings.Repeat("a", 10)}, "\x00\x01\x01\xff4" + strings.Repeat("a", 10)},
+		{4, testPacket{MESSAGE, MessageText, "hello"}, "4hello"},
+		{4, testPacket{MESSAGE, MessageBinary, "\x01\x02\x03"}, "bAQID"},
+		{4, testPacket{CLOSE, MessageText, ""}, "1"},
+	}
+	for _, tt := range tests {
+		p := tt.packet
+		got := encodePayload(tt.protocol, p.msgType, p.typ, []byte(p.data))
+		if !bytes.Equal(got, []byte(tt.want)) {
+			t.Errorf("EIO=%d %v: got %q, want %q", tt.protocol, p, got, tt.want)
+			continue
+		}
+		decoded, err := decodePayload(string(got), tt.protocol, 0)
+		if err != nil || len(decoded) != 1 || decoded[0] != p {
+			t.Errorf("EIO=%d %v: decoded %v, %v", tt.protocol, p, decoded, err)
+		}
+	}
+}
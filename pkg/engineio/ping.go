@@ -0,0 +1,79 @@
+package engineio
+
+import "time"
+
+// pingLoop drives the heartbeat: with EIO=3 the client sends the pings and
+// waits for the pongs, with EIO=4 the server sends the pings and the client
+// only checks they keep coming.
+func (c *Conn) pingLoop() {
+	defer c.wg.Done()
+	if c.protocol >= 4 {
+		c.pingTimeoutLoop()
+		return
+	}
+	lastPing := time.Now()
+	lastTry := lastPing
+	var pingSent time.Time // zero while no ping waits for its pong
+	for {
+		now := time.Now()
+		pingDiff := now.Sub(lastPing)
+		tryDiff := now.Sub(lastTry)
+		select {
+		case ok := <-c.pingChan:
+			if !ok {
+				return
+			}
+			lastPing = time.Now()
+			lastTry = lastPing
+			if !pingSent.IsZero() {
+				if f := c.options.OnPingRoundTrip; f != nil {
+					f(lastPing.Sub(pingSent))
+				}
+				pingSent = time.Time{}
+			}
+		case <-time.After(c.pingInterval - tryDiff):
+			if c.State() == StateUpgrading {
+				// the ping could be held by the server along the old transport.
+				lastTry = time.Now()
+				continue
+			}
+			c.options.logger().Debug("ping")
+			c.writerLocker.Lock()
+			if w, _ := c.getCurrent().NextWriter(MessageText, PING); w != nil {
+				w.Close()
+				pingSent = time.Now()
+			}
+			c.writerLocker.Unlock()
+			lastTry = time.Now()
+		case <-time.After(c.pingInterval + c.pingTimeout - pingDiff):
+			// like the js client, the pong of the ping sent after pingInterval
+			// is waited for pingTimeout.
+			c.options.logger().Warn("ping timeout", "timeout", c.pingInterval+c.pingTimeout)
+			c.setErr(PingTimeoutError)
+			c.Close()
+			return
+		}
+	}
+}
+
+func (c *Conn) pingTimeoutLoop() {
+	timer := time.NewTimer(c.pingInterval + c.pingTimeout)
+	defer timer.Stop()
+	for {
+		select {
+		case ok := <-c.pingChan:
+			if !ok {
+				return
+			}
+			if !timer.Stop() {
+				<-timer.C
+			}
+			timer.Reset(c.pingInterval + c.pingTimeout)
+		case <-timer.C:
+			c.options.logger().Warn("ping timeout", "timeout", c.pingInterval+c.pingTimeout)
+			c.setErr(PingTimeoutError)
+			c.Close()
+			return
+		}
+	}
+}
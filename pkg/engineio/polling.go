@@ -0,0 +1,235 @@
+package engineio
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+var PayloadTooLargeError = errors.New("payload too large")
+
+// polling is the XHR polling transport. It speaks the protocol revision asked
+// by the EIO query parameter, unless the handshake response shows the server
+// answered with another one.
+type polling struct {
+	locker     sync.Mutex
+	url        url.URL
+	header     http.Header
+	options    *Options
+	seq        uint
+	protocol   int
+	maxPayload int
+	closed     bool
+	ctx        context.Context
+	cancel     context.CancelFunc // aborts the pending requests on Close
+
+	getResp *http.Response
+	body    *bufio.Reader // of getResp
+	payload payloadDecoder
+}
+
+// newPolling returns the polling transport at u, its requests are aborted
+// once ctx is done.
+func newPolling(ctx context.Context, u *url.URL, opts *Options, protocol int) *polling {
+	ctx, cancel := context.WithCancel(ctx)
+	return &polling{
+		url:      *u,
+		header:   opts.Header,
+		options:  opts,
+		protocol: protocol,
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+func (p *polling) Name() string {
+	return "polling"
+}
+
+// Protocol returns the engine.io protocol revision used by the transport.
+func (p *polling) Protocol() int {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+	return p.protocol
+}
+
+func (p *polling) setMaxPayload(n int) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+	p.maxPayload = n
+}
+
+// buffered tells whether NextReader returns a packet of the last payload,
+// rather than sending a new request. It must not run along NextReader.
+func (p *polling) buffered() bool {
+	p.locker.Lock()
+	payload, body := p.payload, p.body
+	p.locker.Unlock()
+	if payload == nil {
+		return false
+	}
+	if _, err := body.Peek(1); err != nil {
+		p.getResp.Body.Close()
+		p.setPayload(nil)
+		return false
+	}
+	return true
+}
+
+func (p *polling) NextReader() (*packetReader, error) {
+	if p.isClosed() {
+		return nil, io.EOF
+	}
+	p.locker.Lock()
+	payload := p.payload
+	p.locker.Unlock()
+	if payload != nil {
+		ret, err := payload.Next()
+		if err != io.EOF {
+			return ret, err
+		}
+		p.getResp.Body.Close()
+		p.setPayload(nil)
+	}
+	resp, err := p.do("GET", "", nil)
+	if err != nil {
+		return nil, err
+	}
+	p.getResp = resp
+	body := bufio.NewReader(resp.Body)
+	protocol := p.Protocol()
+	if p.url.Query().Get("sid") == "" {
+		// the handshake tells the revision of the server: an EIO=4 payload
+		// starts with the open packet itself, an EIO=3 one with its length.
+		protocol = 3
+		if b, _ := body.Peek(2); len(b) == 2 && b[0] == '0' && b[1] == '{' {
+			protocol = 4
+		}
+		p.locker.Lock()
+		p.protocol = protocol
+		p.locker.Unlock()
+	}
+	var max int
+	if m := p.options.maxMessageSize(); m > 0 {
+		max = encodedLimit(m)
+	}
+	payload = newPayloadDecoder(body, protocol, max)
+	p.locker.Lock()
+	p.body = body
+	p.locker.Unlock()
+	p.setPayload(payload)
+	ret, err := payload.Next()
+	if err == io.EOF {
+		// an empty payload.
+		p.getResp.Body.Close()
+		p.setPayload(nil)
+		return newPacketReader(bytes.NewReader(nil), NOOP, MessageText), nil
+	}
+	return ret, err
+}
+
+func (p *polling) setPayload(d payloadDecoder) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+	p.payload = d
+}
+
+func (p *polling) NextWriter(msgType MessageType, t PacketType) (io.WriteCloser, error) {
+	if p.isClosed() {
+		return nil, io.EOF
+	}
+	return &pollingWriter{
+		polling: p,
+		msgType: msgType,
+		typ:     t,
+	}, nil
+}
+
+func (p *polling) Close() error {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+	p.closed = true
+	p.cancel()
+	return nil
+}
+
+func (p *polling) isClosed() bool {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+	return p.closed
+}
+
+func (p *polling) do(method, contentType string, body []byte) (*http.Response, error) {
+	p.locker.Lock()
+	u := p.url
+	query := u.Query()
+	query.Set("t", fmt.Sprintf("%d-%d", time.Now().Unix()*1000, p.seq))
+	p.seq++
+	p.locker.Unlock()
+
+	u.RawQuery = query.Encode()
+	req, err := http.NewRequestWithContext(p.ctx, method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	// the client adds the cookies of its jar to the header, which is shared.
+	req.Header = p.header.Clone()
+	if req.Header == nil {
+		req.Header = http.Header{}
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		req.ContentLength = int64(len(body))
+	}
+	if err := p.options.decorate(req); err != nil {
+		return nil, err
+	}
+	resp, err := p.options.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("polling %s: %s", method, resp.Status)
+	}
+	return resp, nil
+}
+
+type pollingWriter struct {
+	bytes.Buffer
+	polling *polling
+	msgType MessageType
+	typ     PacketType
+}
+
+func (w *pollingWriter) Close() error {
+	p := w.polling
+	protocol := p.Protocol()
+	payload := encodePayload(protocol, w.msgType, w.typ, w.Bytes())
+	p.locker.Lock()
+	max := p.maxPayload
+	p.locker.Unlock()
+	if max > 0 && len(payload) > max {
+		return PayloadTooLargeError
+	}
+	contentType := "text/plain;charset=UTF-8"
+	if protocol < 4 {
+		// EIO=3 payloads are always sent in the binary format.
+		contentType = "application/octet-stream"
+	}
+	resp, err := p.do("POST", contentType, payload)
+	if err != nil {
+		return err
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	return resp.Body.Close()
+}
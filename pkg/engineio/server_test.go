@@ -0,0 +1,351 @@
+package engineio
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf16"
+
+	"github.com/gorilla/websocket"
+)
+
+// testServer is an engine.io server speaking the protocol revision asked by
+// the EIO query parameter, or Protocol when set. It opens the sessions over
+// polling or websocket, answers the upgrade probe and drives the heartbeat:
+// it sends the pings with EIO=4 and answers them with EIO=3. The messages
+// received are handed to OnMessage.
+type testServer struct {
+	*httptest.Server
+
+	Protocol     int
+	PingInterval time.Duration
+	PingTimeout  time.Duration
+	MaxPayload   int
+	Upgrades     []string
+	// Silent stops the heartbeat of the server: no ping with EIO=4, no pong with EIO=3.
+	Silent    bool
+	OnMessage func(s *testSession, m testPacket)
+
+	mu       sync.Mutex
+	sessions map[string]*testSession
+	seq      int
+}
+
+func newTestServer(t *testing.T) *testServer {
+	s := &testServer{
+		PingInterval: 200 * time.Millisecond,
+		PingTimeout:  200 * time.Millisecond,
+		MaxPayload:   1000000,
+		sessions:     map[string]*testSession{},
+	}
+	s.Server = httptest.NewUnstartedServer(s)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func startTestServer(t *testing.T) *testServer {
+	s := newTestServer(t)
+	s.Start()
+	return s
+}
+
+// Close closes the sessions, then the server.
+func (s *testServer) Close() {
+	s.mu.Lock()
+	sessions := s.sessions
+	s.sessions = map[string]*testSession{}
+	s.mu.Unlock()
+	for _, sess := range sessions {
+		sess.close()
+	}
+	s.Server.CloseClientConnections()
+	s.Server.Close()
+}
+
+// Session waits for the first session to open.
+func (s *testServer) Session(t *testing.T) *testSession {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		s.mu.Lock()
+		sess := s.sessions["sid1"]
+		s.mu.Unlock()
+		if sess != nil {
+			return sess
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("no session opened")
+	return nil
+}
+
+// testSession is an engine.io session of the testServer.
+type testSession struct {
+	s        *testServer
+	sid      string
+	protocol int
+	mu       sync.Mutex
+	ws       *websocket.Conn
+	upgraded bool
+	queue    chan testPacket
+	closed   chan struct{}
+	once     sync.Once
+}
+
+// Send sends the packet p to the client.
+func (sess *testSession) Send(p testPacket) {
+	sess.mu.Lock()
+	if sess.upgraded {
+		sess.writeFrame(sess.ws, p)
+		sess.mu.Unlock()
+		return
+	}
+	sess.mu.Unlock()
+	select {
+	case sess.queue <- p:
+	case <-sess.closed:
+	}
+}
+
+// writeFrame must be called with mu held.
+func (sess *testSession) writeFrame(ws *websocket.Conn, p testPacket) {
+	if p.msgType == MessageBinary {
+		data := []byte(p.data)
+		if sess.protocol < 4 {
+			data = append([]byte{byte(p.typ)}, data...)
+		}
+		ws.WriteMessage(websocket.BinaryMessage, data)
+		return
+	}
+	ws.WriteMessage(websocket.TextMessage, []byte(strconv.Itoa(int(p.typ))+p.data))
+}
+
+func (sess *testSession) close() {
+	sess.once.Do(func() {
+		close(sess.closed)
+		sess.mu.Lock()
+		if sess.ws != nil {
+			sess.ws.Close()
+		}
+		sess.mu.Unlock()
+	})
+}
+
+func (sess *testSession) pingLoop() {
+	for {
+		select {
+		case <-time.After(sess.s.PingInterval):
+			sess.Send(testPacket{PING, MessageText, ""})
+		case <-sess.closed:
+			return
+		}
+	}
+}
+
+func (sess *testSession) noopLoop() {
+	for {
+		sess.mu.Lock()
+		upgraded := sess.upgraded
+		sess.mu.Unlock()
+		if upgraded {
+			return
+		}
+		select {
+		case sess.queue <- testPacket{NOOP, MessageText, ""}:
+		case <-sess.closed:
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func (sess *testSession) onPacket(p testPacket) {
+	switch p.typ {
+	case CLOSE:
+		sess.close()
+	case PING:
+		if !sess.s.Silent {
+			sess.Send(testPacket{PONG, MessageText, p.data})
+		}
+	case MESSAGE:
+		if f := sess.s.OnMessage; f != nil {
+			f(sess, p)
+		}
+	}
+}
+
+func (s *testServer) open(protocol int) *testSession {
+	if s.Protocol > 0 {
+		protocol = s.Protocol
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	sess := &testSession{
+		s:        s,
+		sid:      fmt.Sprintf("sid%d", s.seq),
+		protocol: protocol,
+		queue:    make(chan testPacket, 64),
+		closed:   make(chan struct{}),
+	}
+	s.sessions[sess.sid] = sess
+	if protocol >= 4 && !s.Silent {
+		go sess.pingLoop()
+	}
+	return sess
+}
+
+func (s *testServer) get(sid string) *testSession {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sessions[sid]
+}
+
+// handshake returns the open packet of sess, only EIO=4 servers send maxPayload.
+func (s *testServer) handshake(sess *testSession) testPacket {
+	upgrades := `[]`
+	if len(s.Upgrades) > 0 {
+		upgrades = `["` + strings.Join(s.Upgrades, `","`) + `"]`
+	}
+	maxPayload := ""
+	if sess.protocol >= 4 {
+		maxPayload = fmt.Sprintf(`,"maxPayload":%d`, s.MaxPayload)
+	}
+	return testPacket{OPEN, MessageText, fmt.Sprintf(`{"sid":"%s","upgrades":%s,"pingInterval":%d,"pingTimeout":%d%s}`,
+		sess.sid, upgrades, s.PingInterval.Milliseconds(), s.PingTimeout.Milliseconds(), maxPayload)}
+}
+
+func (s *testServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	sid := q.Get("sid")
+	protocol, _ := strconv.Atoi(q.Get("EIO"))
+	if q.Get("transport") == "websocket" {
+		s.serveWebsocket(w, r, sid, protocol)
+		return
+	}
+	if sid == "" {
+		sess := s.open(protocol)
+		w.Write(encodeTestPayload(sess.protocol, []testPacket{s.handshake(sess)}))
+		return
+	}
+	sess := s.get(sid)
+	if sess == nil {
+		http.Error(w, "unknown sid", http.StatusBadRequest)
+		return
+	}
+	if r.Method == http.MethodPost {
+		b, _ := io.ReadAll(r.Body)
+		packets, err := decodePayload(string(b), sess.protocol, 0)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for _, p := range packets {
+			sess.onPacket(p)
+		}
+		io.WriteString(w, "ok")
+		return
+	}
+	select {
+	case p := <-sess.queue:
+		packets := []testPacket{p}
+		for len(sess.queue) > 0 {
+			packets = append(packets, <-sess.queue)
+		}
+		w.Write(encodeTestPayload(sess.protocol, packets))
+	case <-sess.closed:
+		w.Write(encodeTestPayload(sess.protocol, []testPacket{{CLOSE, MessageText, ""}}))
+	case <-r.Context().Done():
+	}
+}
+
+func (s *testServer) serveWebsocket(w http.ResponseWriter, r *http.Request, sid string, protocol int) {
+	var sess *testSession
+	if sid != "" {
+		if sess = s.get(sid); sess == nil {
+			http.Error(w, "unknown sid", http.StatusBadRequest)
+			return
+		}
+	}
+	up := websocket.Upgrader{}
+	ws, err := up.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer ws.Close()
+	if sess == nil {
+		sess = s.open(protocol)
+		sess.mu.Lock()
+		sess.ws = ws
+		sess.upgraded = true
+		sess.writeFrame(ws, s.handshake(sess))
+		sess.mu.Unlock()
+	}
+	for {
+		typ, b, err := ws.ReadMessage()
+		if err != nil {
+			sess.close()
+			return
+		}
+		var p testPacket
+		switch {
+		case typ == websocket.BinaryMessage && sess.protocol >= 4:
+			p = testPacket{MESSAGE, MessageBinary, string(b)}
+		case typ == websocket.BinaryMessage && len(b) > 0:
+			p = testPacket{PacketType(b[0]), MessageBinary, string(b[1:])}
+		case len(b) > 0:
+			p = testPacket{PacketType(b[0] - '0'), MessageText, string(b[1:])}
+		}
+		switch {
+		case p.typ == PING && p.data == "probe":
+			sess.mu.Lock()
+			sess.ws = ws
+			sess.writeFrame(ws, testPacket{PONG, MessageText, "probe"})
+			sess.mu.Unlock()
+			// like engine.io, release the pending polls until the client upgrades.
+			go sess.noopLoop()
+		case p.typ == UPGRADE:
+			sess.mu.Lock()
+			sess.upgraded = true
+			sess.mu.Unlock()
+		default:
+			sess.onPacket(p)
+		}
+	}
+}
+
+// encodeTestPayload encodes the polling payload of packets the way a server
+// does: with EIO=3, in the binary format when a packet is binary and in the
+// text one otherwise.
+func encodeTestPayload(protocol int, packets []testPacket) []byte {
+	var buf bytes.Buffer
+	if protocol >= 4 {
+		for i, p := range packets {
+			if i > 0 {
+				buf.WriteByte(recordSeparator)
+			}
+			buf.Write(encodePayload(protocol, p.msgType, p.typ, []byte(p.data)))
+		}
+		return buf.Bytes()
+	}
+	binary := false
+	for _, p := range packets {
+		binary = binary || p.msgType == MessageBinary
+	}
+	for _, p := range packets {
+		if binary {
+			buf.Write(encodePayload(protocol, p.msgType, p.typ, []byte(p.data)))
+			continue
+		}
+		packet := strconv.Itoa(int(p.typ)) + p.data
+		fmt.Fprintf(&buf, "%d:%s", len(utf16.Encode([]rune(packet))), packet)
+	}
+	return buf.Bytes()
+}
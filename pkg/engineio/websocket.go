@@ -0,0 +1,106 @@
+package engineio
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// websocketTransport is the websocket transport. With EIO=4 binary frames
+// carry the raw message, without the packet type byte of EIO=3.
+type websocketTransport struct {
+	conn     *websocket.Conn
+	protocol int
+
+	// Close is called by both Conn.Close and the readLoop once the server answered.
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// dialWebsocket opens the websocket transport at u, whose scheme is switched
+// to ws or wss. ctx only bounds the dial.
+func dialWebsocket(ctx context.Context, u *url.URL, opts *Options, protocol int) (*websocketTransport, error) {
+	wsURL := *u
+	switch wsURL.Scheme {
+	case "https":
+		wsURL.Scheme = "wss"
+	case "http":
+		wsURL.Scheme = "ws"
+	}
+	req, err := newRequest(ctx, "GET", &wsURL, opts)
+	if err != nil {
+		return nil, err
+	}
+	conn, _, err := opts.dialer().DialContext(req.Context(), req.URL.String(), req.Header)
+	if err != nil {
+		return nil, err
+	}
+	if max := opts.maxMessageSize(); max > 0 {
+		// the frames start with the packet type.
+		conn.SetReadLimit(max + 1)
+	}
+	return &websocketTransport{
+		conn:     conn,
+		protocol: protocol,
+	}, nil
+}
+
+func (t *websocketTransport) Name() string {
+	return "websocket"
+}
+
+func (t *websocketTransport) NextReader() (*packetReader, error) {
+	for {
+		typ, r, err := t.conn.NextReader()
+		if err == websocket.ErrReadLimit {
+			return nil, MessageTooLargeError
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch typ {
+		case websocket.BinaryMessage:
+			if t.protocol >= 4 {
+				return newPacketReader(r, MESSAGE, MessageBinary), nil
+			}
+			fallthrough
+		case websocket.TextMessage:
+			return readPacket(r)
+		}
+	}
+}
+
+func (t *websocketTransport) NextWriter(msgType MessageType, typ PacketType) (io.WriteCloser, error) {
+	if msgType == MessageBinary {
+		w, err := t.conn.NextWriter(websocket.BinaryMessage)
+		if err != nil {
+			return nil, err
+		}
+		if t.protocol < 4 {
+			if _, err := w.Write([]byte{byte(typ)}); err != nil {
+				w.Close()
+				return nil, err
+			}
+		}
+		return w, nil
+	}
+	w, err := t.conn.NextWriter(websocket.TextMessage)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write([]byte{byte(typ) + '0'}); err != nil {
+		w.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+func (t *websocketTransport) Close() error {
+	t.closeOnce.Do(func() {
+		t.closeErr = t.conn.Close()
+	})
+	return t.closeErr
+}
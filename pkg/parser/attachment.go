@@ -0,0 +1,292 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// Attachment is an attachment handler used in emit args. All attachments will send as binary in transport layer. When use attachment, make sure use as pointer.
+//
+// For example:
+//
+//	type Arg struct {
+//	    Title string `json:"title"`
+//	    File *Attachment `json:"file"`
+//	}
+//
+//	f, _ := os.Open("./some_file")
+//	arg := Arg{
+//	    Title: "some_file",
+//	    File: &Attachment{
+//	        Data: f,
+//	    }
+//	}
+//
+//	socket.Emit("send file", arg)
+//	socket.On("get file", func(so Socket, arg Arg) {
+//	    b, _ := ioutil.ReadAll(arg.File.Data)
+//	})
+//
+// The data is copied into Data when it is set on receive, else Data gets a
+// buffer, or a stream of the frame when the Decoder streams the attachments.
+type Attachment struct {
+
+	// Data is the ReadWriter of the attachment data.
+	Data io.ReadWriter
+
+	// Progress is called while the attachment is sent, with the bytes sent so far.
+	Progress func(sent int64)
+	num      int
+}
+
+// NewAttachment returns an attachment sending the data of r, its Data is
+// read only.
+func NewAttachment(r io.Reader) *Attachment {
+	return &Attachment{
+		Data: readOnly{r},
+	}
+}
+
+// Close closes Data when it is an io.Closer. The attachments streamed by a
+// Decoder are closed once read, or given up: the rest of their frame is
+// dropped and their spool, which may be a temp file, released.
+func (a *Attachment) Close() error {
+	if c, ok := a.Data.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// readOnly is the Data of the attachments which can only be read.
+type readOnly struct {
+	io.Reader
+}
+
+func (readOnly) Write([]byte) (int, error) {
+	return 0, ReadOnlyError
+}
+
+// progressReader reports the bytes read from r.
+type progressReader struct {
+	r        io.Reader
+	n        int64
+	progress func(int64)
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.n += int64(n)
+		r.progress(r.n)
+	}
+	return n, err
+}
+
+var attachmentType = reflect.TypeOf(Attachment{})
+
+// attachmentOf returns the attachment v holds, which must be addressable to
+// be numbered or filled: Attachment values copied into an interface or a map
+// fail with AttachmentValueError.
+func attachmentOf(v reflect.Value) (*Attachment, error) {
+	if !v.CanAddr() {
+		return nil, AttachmentValueError
+	}
+	return v.Addr().Interface().(*Attachment), nil
+}
+
+// EncodeAttachments numbers the attachments found in v and returns their data
+// in order, to be sent after the packet.
+func EncodeAttachments(v interface{}) ([]io.Reader, error) {
+	index := 0
+	return encodeAttachmentValue(reflect.ValueOf(v), &index)
+}
+
+func encodeAttachmentValue(v reflect.Value, index *int) ([]io.Reader, error) {
+	v = reflect.Indirect(v)
+	var ret []io.Reader
+	if !v.IsValid() {
+		return ret, nil
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		if v.Type() == attachmentType {
+			a, err := attachmentOf(v)
+			if err != nil {
+				return nil, err
+			}
+			a.num = *index
+			if a.Progress != nil {
+				ret = append(ret, &progressReader{r: a.Data, progress: a.Progress})
+			} else {
+				ret = append(ret, a.Data)
+			}
+			*index++
+			return ret, nil
+		}
+		for i, n := 0, v.NumField(); i < n; i++ {
+			r, err := encodeAttachmentValue(v.Field(i), index)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, r...)
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			return ret, nil
+		}
+		for _, key := range v.MapKeys() {
+			r, err := encodeAttachmentValue(v.MapIndex(key), index)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, r...)
+		}
+	case reflect.Slice:
+		if v.IsNil() {
+			return ret, nil
+		}
+		fallthrough
+	case reflect.Array:
+		for i, n := 0, v.Len(); i < n; i++ {
+			r, err := encodeAttachmentValue(v.Index(i), index)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, r...)
+		}
+	case reflect.Interface:
+		return encodeAttachmentValue(reflect.ValueOf(v.Interface()), index)
+	}
+	return ret, nil
+}
+
+// DecodeAttachments fills the attachments found in v with the binary
+// attachments of the packet their placeholders refer to.
+func DecodeAttachments(v interface{}, binary [][]byte) error {
+	b := &Binary{}
+	for _, data := range binary {
+		b.parts = append(b.parts, inMemory(data))
+	}
+	return b.Decode(v)
+}
+
+// Binary holds the attachments of a packet read by DecodeRaw, in memory or
+// spooled to a temp file, they can be decoded several times.
+type Binary struct {
+	parts  []*spooled
+	stream bool // hand the parts out instead of copying them
+}
+
+// Len returns the number of attachments.
+func (b *Binary) Len() int {
+	return len(b.parts)
+}
+
+// Decode fills the attachments found in v as DecodeAttachments does. With a
+// streaming Decoder, the attachments without Data read the spooled part.
+func (b *Binary) Decode(v interface{}) error {
+	var attachments []*Attachment
+	if err := collectAttachments(reflect.ValueOf(v), &attachments); err != nil {
+		return err
+	}
+	for _, a := range attachments {
+		if a.num >= len(b.parts) || a.num < 0 {
+			return &PacketError{Err: InvalidAttachmentsError, Detail: fmt.Sprintf("placeholder %d out of range", a.num)}
+		}
+		part := io.NewSectionReader(b.parts[a.num], 0, b.parts[a.num].Size())
+		if a.Data == nil {
+			if b.stream {
+				a.Data = readOnly{part}
+				continue
+			}
+			a.Data = bytes.NewBuffer(nil)
+		}
+		if _, err := io.Copy(a.Data, part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close releases the spooled attachments, the ones handed out by Decode read
+// them, they are not closed on their own.
+func (b *Binary) Close() error {
+	if b == nil {
+		return nil
+	}
+	var err error
+	for _, part := range b.parts {
+		if cerr := part.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// collectAttachments appends the attachments found in v to ret.
+func collectAttachments(v reflect.Value, ret *[]*Attachment) error {
+	v = reflect.Indirect(v)
+	if !v.IsValid() {
+		// a nil pointer or interface holds no attachment.
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		if v.Type() == attachmentType {
+			a, err := attachmentOf(v)
+			if err != nil {
+				return err
+			}
+			*ret = append(*ret, a)
+			return nil
+		}
+		for i, n := 0, v.NumField(); i < n; i++ {
+			if err := collectAttachments(v.Field(i), ret); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		for _, key := range v.MapKeys() {
+			if err := collectAttachments(v.MapIndex(key), ret); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice:
+		if v.IsNil() {
+			return nil
+		}
+		fallthrough
+	case reflect.Array:
+		for i, n := 0, v.Len(); i < n; i++ {
+			if err := collectAttachments(v.Index(i), ret); err != nil {
+				return err
+			}
+		}
+	case reflect.Interface:
+		if err := collectAttachments(reflect.ValueOf(v.Interface()), ret); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a Attachment) MarshalJSON() ([]byte, error) {
+	return []byte(fmt.Sprintf("{\"_placeholder\":true,\"num\":%d}", a.num)), nil
+}
+
+func (a *Attachment) UnmarshalJSON(b []byte) error {
+	var v struct {
+		Num int `json:"num"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	a.num = v.Num
+	return nil
+}
@@ -0,0 +1,105 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestEncodeAttachments(t *testing.T) {
+	type file struct {
+		Name string      `json:"name"`
+		Data *Attachment `json:"data"`
+	}
+	v := []interface{}{
+		"upload",
+		file{Name: "a", Data: NewAttachment(strings.NewReader("first"))},
+		[]*Attachment{NewAttachment(strings.NewReader("second"))},
+		map[string]*Attachment{"k": NewAttachment(strings.NewReader("third"))},
+	}
+	readers, err := EncodeAttachments(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, r := range readers {
+		b, _ := ioutil.ReadAll(r)
+		got = append(got, string(b))
+	}
+	if strings.Join(got, ",") != "first,second,third" {
+		t.Fatalf("attachments %q", got)
+	}
+	b, _ := json.Marshal(v)
+	want := `["upload",{"name":"a","data":{"_placeholder":true,"num":0}},[{"_placeholder":true,"num":1}],{"k":{"_placeholder":true,"num":2}}]`
+	if string(b) != want {
+		t.Fatalf("json %s, want %s", b, want)
+	}
+}
+
+func TestDecodeAttachments(t *testing.T) {
+	var v struct {
+		Files []*Attachment `json:"files"`
+		One   Attachment    `json:"one"`
+	}
+	err := json.Unmarshal([]byte(`{"files":[{"_placeholder":true,"num":1}],"one":{"_placeholder":true,"num":0}}`), &v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := DecodeAttachments(&v, [][]byte{[]byte("zero"), []byte("one")}); err != nil {
+		t.Fatal(err)
+	}
+	read := func(a *Attachment) string {
+		b, _ := ioutil.ReadAll(a.Data)
+		return string(b)
+	}
+	if got := read(v.Files[0]) + "," + read(&v.One); got != "one,zero" {
+		t.Fatalf("attachments %q", got)
+	}
+
+	var out struct {
+		File *Attachment `json:"file"`
+	}
+	json.Unmarshal([]byte(`{"file":{"_placeholder":true,"num":2}}`), &out)
+	if err := DecodeAttachments(&out, [][]byte{[]byte("zero")}); !isPacketError(err, InvalidAttachmentsError) {
+		t.Fatalf("err = %v, want InvalidAttachmentsError", err)
+	}
+}
+
+func isPacketError(err error, want error) bool {
+	pe, ok := err.(*PacketError)
+	return ok && pe.Err == want
+}
+
+func TestAttachmentValues(t *testing.T) {
+	a := Attachment{Data: bytes.NewBufferString("data")}
+	for _, v := range []interface{}{
+		[]interface{}{a},
+		map[string]Attachment{"k": a},
+	} {
+		if _, err := EncodeAttachments(v); err != AttachmentValueError {
+			t.Errorf("EncodeAttachments(%T) = %v, want AttachmentValueError", v, err)
+		}
+		if err := DecodeAttachments(v, [][]byte{[]byte("data")}); err != AttachmentValueError {
+			t.Errorf("DecodeAttachments(%T) = %v, want AttachmentValueError", v, err)
+		}
+	}
+}
+
+func TestAttachmentLookalike(t *testing.T) {
+	// another type named Attachment is no attachment.
+	type Attachment struct {
+		Data io.Reader `json:"-"`
+		Name string    `json:"name"`
+	}
+	v := []interface{}{Attachment{Name: "a"}, map[string]Attachment{"k": {Name: "b"}}}
+	readers, err := EncodeAttachments(v)
+	if err != nil || len(readers) != 0 {
+		t.Fatalf("EncodeAttachments = %d readers, %v", len(readers), err)
+	}
+	if err := DecodeAttachments(v, nil); err != nil {
+		t.Fatal(err)
+	}
+}
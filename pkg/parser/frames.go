@@ -0,0 +1,84 @@
+package parser
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+
+	"github.com/weblfe/webss/pkg/engineio"
+)
+
+// Frame is an engine.io message holding a packet or one of its attachments.
+type Frame struct {
+	Type engineio.MessageType
+	Data []byte
+}
+
+// Frames lets the Encoder and the Decoder work on byte slices: an Encoder
+// appends its frames to them, Reader returns them to a Decoder.
+type Frames []Frame
+
+func (f *Frames) NextWriter(t engineio.MessageType) (io.WriteCloser, error) {
+	return &frameWriter{
+		frames: f,
+		typ:    t,
+	}, nil
+}
+
+// Reader returns a FrameReader of the frames, it returns io.EOF after the last one.
+func (f Frames) Reader() FrameReader {
+	return &framesReader{
+		frames: f,
+	}
+}
+
+// Marshal encodes v to its frames, the packet followed by its attachments.
+func Marshal(v Packet) (Frames, error) {
+	var f Frames
+	if err := NewEncoder(&f).Encode(v); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Unmarshal decodes the packet held by f into v, whose Data must be a
+// pointer to the value receiving the data. The name of an event is returned
+// apart, its arguments are decoded into v.Data.
+func Unmarshal(f Frames, v *Packet) (message string, err error) {
+	d := NewDecoder(f.Reader())
+	defer d.Close()
+	if err := d.Decode(v); err != nil {
+		return "", err
+	}
+	if v.Data == nil {
+		return d.Message(), nil
+	}
+	return d.Message(), d.DecodeData(v)
+}
+
+type frameWriter struct {
+	bytes.Buffer
+	frames *Frames
+	typ    engineio.MessageType
+}
+
+func (w *frameWriter) Close() error {
+	*w.frames = append(*w.frames, Frame{
+		Type: w.typ,
+		Data: w.Bytes(),
+	})
+	return nil
+}
+
+type framesReader struct {
+	frames Frames
+}
+
+func (r *framesReader) NextReader() (engineio.MessageType, io.ReadCloser, error) {
+	if len(r.frames) == 0 {
+		return engineio.MessageBinary, nil, io.EOF
+	}
+	f := r.frames[0]
+	r.frames = r.frames[1:]
+	return f.Type, ioutil.NopCloser(bytes.NewReader(f.Data)), nil
+}
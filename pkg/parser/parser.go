@@ -0,0 +1,573 @@
+// Package parser encodes and decodes socket.io packets, revisions 4 and 5 of
+// the protocol, over the frames of an engine.io connection.
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"strconv"
+	"sync"
+
+	"github.com/weblfe/webss/pkg/engineio"
+)
+
+const Protocol = 4
+
+// Type is the type of a socket.io packet.
+type Type int
+
+const (
+	CONNECT Type = iota
+	DISCONNECT
+	EVENT
+	ACK
+	ERROR
+	BINARY_EVENT
+	BINARY_ACK
+)
+
+func (t Type) String() string {
+	switch t {
+	case CONNECT:
+		return "connect"
+	case DISCONNECT:
+		return "disconnect"
+	case EVENT:
+		return "event"
+	case ACK:
+		return "ack"
+	case ERROR:
+		return "error"
+	case BINARY_EVENT:
+		return "binary_event"
+	case BINARY_ACK:
+		return "binary_ack"
+	}
+	return fmt.Sprintf("unknown(%d)", t)
+}
+
+var (
+	InvalidTypeError        = errors.New("invalid packet type")
+	InvalidAttachmentsError = errors.New("invalid attachments")
+	InvalidIdError          = errors.New("invalid packet id")
+	InvalidPayloadError     = errors.New("invalid payload")
+	UnexpectedFrameError    = errors.New("unexpected frame")
+	LimitError              = errors.New("limit exceeded")
+	ReadOnlyError           = errors.New("attachment is read only")
+	AttachmentValueError    = errors.New("attachment passed by value, use *Attachment")
+	AttachmentClosedError   = errors.New("attachment is closed")
+)
+
+// Limits bounds the packets read by a Decoder, 0 means unlimited. They are
+// checked while reading, a packet exceeding them fails with LimitError.
+type Limits struct {
+	MaxPacketSize     int64 // bytes of the text frame of a packet
+	MaxAttachments    int   // attachments of a packet
+	MaxAttachmentSize int64 // bytes of an attachment
+	MaxDepth          int   // nesting of the arrays and objects of the payload
+}
+
+// PacketError is returned for a malformed packet, errors.Is matches it with
+// one of the errors above.
+type PacketError struct {
+	Err    error  // why the packet is malformed
+	Detail string // what was found instead, if known
+}
+
+func (e *PacketError) Error() string {
+	if e.Detail == "" {
+		return "invalid packet: " + e.Err.Error()
+	}
+	return "invalid packet: " + e.Err.Error() + ": " + e.Detail
+}
+
+func (e *PacketError) Unwrap() error {
+	return e.Err
+}
+
+// FrameReader reads the frames of an engine.io connection, like engineio.Conn.
+type FrameReader interface {
+	NextReader() (engineio.MessageType, io.ReadCloser, error)
+}
+
+// FrameWriter writes the frames of an engine.io connection, like engineio.Conn.
+type FrameWriter interface {
+	NextWriter(engineio.MessageType) (io.WriteCloser, error)
+}
+
+// Packet is a socket.io packet. Id is -1 when the packet has none.
+type Packet struct {
+	Type        Type
+	NSP         string
+	Id          int
+	Data        interface{}
+	Attachments int // number of binary attachments following the packet
+}
+
+type Encoder struct {
+	w FrameWriter
+}
+
+func NewEncoder(w FrameWriter) *Encoder {
+	return &Encoder{
+		w: w,
+	}
+}
+
+// Encode writes v, then the attachments found in its data. EVENT and ACK
+// packets with attachments are sent as BINARY_EVENT and BINARY_ACK.
+func (e *Encoder) Encode(v Packet) error {
+	attachments, err := EncodeAttachments(v.Data)
+	if err != nil {
+		return err
+	}
+	v.Attachments = len(attachments)
+	if v.Attachments > 0 {
+		v.Type += BINARY_EVENT - EVENT
+	}
+	if err := e.encodePacket(v); err != nil {
+		return err
+	}
+	for _, a := range attachments {
+		if err := e.writeBinary(a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *Encoder) encodePacket(v Packet) (err error) {
+	writer, err := e.w.NextWriter(engineio.MessageText)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := writer.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	w := newTrimWriter(writer, "\n")
+	wh := newWriterHelper(w)
+	wh.Write([]byte{byte(v.Type) + '0'})
+	if v.Type == BINARY_EVENT || v.Type == BINARY_ACK {
+		wh.Write([]byte(fmt.Sprintf("%d-", v.Attachments)))
+	}
+	needEnd := false
+	if v.NSP != "" {
+		wh.Write([]byte(v.NSP))
+		needEnd = true
+	}
+	if v.Id >= 0 {
+		f := "%d"
+		if needEnd {
+			f = ",%d"
+			needEnd = false
+		}
+		wh.Write([]byte(fmt.Sprintf(f, v.Id)))
+	}
+	if v.Data != nil {
+		if needEnd {
+			wh.Write([]byte{','})
+			needEnd = false
+		}
+		if wh.Error() != nil {
+			return wh.Error()
+		}
+		encoder := json.NewEncoder(w)
+		return encoder.Encode(v.Data)
+	}
+	return wh.Error()
+}
+
+func (e *Encoder) writeBinary(r io.Reader) (err error) {
+	writer, err := e.w.NextWriter(engineio.MessageBinary)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := writer.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	if _, err := io.Copy(writer, r); err != nil {
+		return err
+	}
+	return nil
+
+}
+
+// Decoder reads packets in two steps: Decode reads the header of the next
+// packet, then DecodeData or DecodeRaw read its data and attachments. Close
+// drops the data and the attachments of a packet which are not read.
+type Decoder struct {
+	reader  FrameReader
+	limits  Limits
+	message string
+	data    []byte // JSON payload of the packet, without the event name
+	pending int    // attachments of the packet not read yet
+	invalid bool   // the data of the packet could not be decoded
+
+	stream    bool
+	threshold int64  // bytes of an attachment spooled in memory
+	dir       string // directory of the spooled attachments
+
+	locker  sync.Mutex // guards the frames read by the streams
+	streams []*attachmentStream
+	next    int               // attachment of the next frame
+	current *attachmentStream // stream reading the current frame
+	err     error
+}
+
+func NewDecoder(r FrameReader) *Decoder {
+	return &Decoder{
+		reader: r,
+	}
+}
+
+// SetLimits bounds the following packets.
+func (d *Decoder) SetLimits(l Limits) {
+	d.limits = l
+}
+
+func (d *Decoder) Close() {
+	if d == nil {
+		return
+	}
+	d.data = nil
+	d.closeStreams(false)
+	for d.pending > 0 {
+		d.pending--
+		_, r, err := d.reader.NextReader()
+		if err != nil {
+			d.pending = 0
+			return
+		}
+		r.Close()
+	}
+}
+
+// Decode reads the next packet into v, its data is kept for DecodeData or
+// DecodeRaw. Malformed packets return a *PacketError.
+func (d *Decoder) Decode(v *Packet) error {
+	d.Close()
+	d.message = ""
+	d.invalid = false
+	ty, r, err := d.reader.NextReader()
+	if err != nil {
+		return err
+	}
+	if ty != engineio.MessageText {
+		r.Close()
+		return &PacketError{Err: UnexpectedFrameError, Detail: "binary frame"}
+	}
+	b, err := readLimited(r, d.limits.MaxPacketSize)
+	r.Close()
+	if err != nil {
+		return err
+	}
+	return d.parse(b, v)
+}
+
+// parse reads a packet encoded as <type>[<attachments>-][<namespace>,][<id>][<payload>].
+func (d *Decoder) parse(b []byte, v *Packet) error {
+	v.NSP = ""
+	v.Id = -1
+	v.Attachments = 0
+
+	if len(b) == 0 || b[0] < '0' || Type(b[0]-'0') > BINARY_ACK {
+		return &PacketError{Err: InvalidTypeError, Detail: quote(b, 1)}
+	}
+	v.Type = Type(b[0] - '0')
+	b = b[1:]
+
+	if v.Type == BINARY_EVENT || v.Type == BINARY_ACK {
+		n := digits(b)
+		if n == 0 || n == len(b) || b[n] != '-' {
+			return &PacketError{Err: InvalidAttachmentsError, Detail: quote(b, n+1)}
+		}
+		num, err := strconv.ParseInt(string(b[:n]), 10, 32)
+		if err != nil {
+			return &PacketError{Err: InvalidAttachmentsError, Detail: quote(b, n)}
+		}
+		if max := d.limits.MaxAttachments; max > 0 && num > int64(max) {
+			return &PacketError{Err: LimitError, Detail: fmt.Sprintf("%d attachments, more than %d", num, max)}
+		}
+		v.Attachments = int(num)
+		// dropped by Close even when the rest of the packet is malformed.
+		d.pending = v.Attachments
+		b = b[n+1:]
+	}
+
+	if len(b) > 0 && b[0] == '/' {
+		n := bytes.IndexByte(b, ',')
+		if n < 0 {
+			n = len(b)
+		}
+		v.NSP = string(b[:n])
+		b = b[n:]
+		if len(b) > 0 {
+			b = b[1:]
+		}
+	}
+
+	if n := digits(b); n > 0 {
+		id, err := strconv.ParseInt(string(b[:n]), 10, 64)
+		if err != nil || id > math.MaxInt32 {
+			return &PacketError{Err: InvalidIdError, Detail: quote(b, n)}
+		}
+		v.Id = int(id)
+		b = b[n:]
+	}
+	if v.Id < 0 && (v.Type == ACK || v.Type == BINARY_ACK) {
+		return &PacketError{Err: InvalidIdError, Detail: "ack without id"}
+	}
+
+	return d.setData(v.Type, b)
+}
+
+// setData checks the payload b fits a packet of type t: an object for
+// CONNECT, a string or an object for ERROR, an array for ACK and an array
+// starting with the event name for EVENT. Only EVENT requires one.
+func (d *Decoder) setData(t Type, b []byte) error {
+	if len(bytes.TrimSpace(b)) == 0 {
+		if t == EVENT || t == BINARY_EVENT {
+			return &PacketError{Err: InvalidPayloadError, Detail: "missing event name"}
+		}
+		return nil
+	}
+	if max := d.limits.MaxDepth; max > 0 && jsonDepth(b) > max {
+		return &PacketError{Err: LimitError, Detail: fmt.Sprintf("payload nested deeper than %d", max)}
+	}
+	if !json.Valid(b) {
+		return &PacketError{Err: InvalidPayloadError, Detail: quote(b, 32)}
+	}
+	var first byte
+	if b := bytes.TrimSpace(b); len(b) > 0 {
+		first = b[0]
+	}
+	switch t {
+	case DISCONNECT:
+		return &PacketError{Err: InvalidPayloadError, Detail: "unexpected payload"}
+	case CONNECT:
+		if first != '{' {
+			return &PacketError{Err: InvalidPayloadError, Detail: "want an object"}
+		}
+	case ERROR:
+		if first != '{' && first != '"' {
+			return &PacketError{Err: InvalidPayloadError, Detail: "want a string or an object"}
+		}
+	case ACK, BINARY_ACK:
+		if first != '[' {
+			return &PacketError{Err: InvalidPayloadError, Detail: "want an array"}
+		}
+	case EVENT, BINARY_EVENT:
+		var args []json.RawMessage
+		if first != '[' || json.Unmarshal(b, &args) != nil {
+			return &PacketError{Err: InvalidPayloadError, Detail: "want an array"}
+		}
+		if len(args) == 0 || json.Unmarshal(args[0], &d.message) != nil {
+			return &PacketError{Err: InvalidPayloadError, Detail: "missing event name"}
+		}
+		buf := bytes.NewBuffer(nil)
+		buf.WriteByte('[')
+		for i, a := range args[1:] {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.Write(a)
+		}
+		buf.WriteByte(']')
+		b = buf.Bytes()
+	}
+	d.data = b
+	return nil
+}
+
+// readLimited reads r up to max bytes, it fails with LimitError without
+// reading more when r is larger.
+func readLimited(r io.Reader, max int64) ([]byte, error) {
+	if max <= 0 {
+		return ioutil.ReadAll(r)
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(r, max+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(b)) > max {
+		return nil, &PacketError{Err: LimitError, Detail: fmt.Sprintf("frame larger than %d bytes", max)}
+	}
+	return b, nil
+}
+
+// jsonDepth returns how deep the arrays and objects of the JSON value b nest.
+func jsonDepth(b []byte) int {
+	depth, max := 0, 0
+	inString, escaped := false, false
+	for _, c := range b {
+		switch {
+		case escaped:
+			escaped = false
+		case inString:
+			switch c {
+			case '\\':
+				escaped = true
+			case '"':
+				inString = false
+			}
+		case c == '"':
+			inString = true
+		case c == '[' || c == '{':
+			depth++
+			if depth > max {
+				max = depth
+			}
+		case c == ']' || c == '}':
+			depth--
+		}
+	}
+	return max
+}
+
+// digits returns the length of the run of digits b starts with.
+func digits(b []byte) int {
+	n := 0
+	for n < len(b) && '0' <= b[n] && b[n] <= '9' {
+		n++
+	}
+	return n
+}
+
+// quote returns the first n bytes of b for an error.
+func quote(b []byte, n int) string {
+	if len(b) == 0 {
+		return "end of packet"
+	}
+	if n < len(b) {
+		b = b[:n]
+	}
+	return strconv.Quote(string(b))
+}
+
+// Err returns the error which stopped the streams of the attachments, the
+// frames which follow cannot be read.
+func (d *Decoder) Err() error {
+	d.locker.Lock()
+	defer d.locker.Unlock()
+	return d.err
+}
+
+// Message returns the event name of the last EVENT or BINARY_EVENT packet.
+func (d *Decoder) Message() string {
+	return d.message
+}
+
+// Invalid tells whether the data of the last packet could not be decoded.
+func (d *Decoder) Invalid() bool {
+	return d.invalid
+}
+
+// DecodeData decodes the data of the packet into v.Data, then fills the
+// attachments it holds. Binary packets come out as EVENT or ACK. The
+// attachments streamed by a streaming Decoder read their frames until it is
+// closed.
+func (d *Decoder) DecodeData(v *Packet) error {
+	if d.data == nil {
+		return nil
+	}
+	defer func() {
+		d.data = nil
+		if d.streams == nil {
+			d.Close()
+		}
+	}()
+	if err := json.Unmarshal(d.data, v.Data); err != nil {
+		d.invalid = true
+		return err
+	}
+	if v.Type == BINARY_EVENT || v.Type == BINARY_ACK {
+		if d.stream {
+			if err := d.streamAttachments(v.Data); err != nil {
+				d.closeStreams(true)
+				d.invalid = true
+				return err
+			}
+		} else {
+			binary, err := d.decodeBinary()
+			if err != nil {
+				return err
+			}
+			if err := binary.Decode(v.Data); err != nil {
+				d.invalid = true
+				return err
+			}
+		}
+		v.Type -= BINARY_EVENT - EVENT
+	}
+	return nil
+}
+
+// DecodeRaw decodes the arguments of the packet as raw JSON values, returning
+// the binary attachments apart so that they can be decoded later with Binary.Decode.
+func (d *Decoder) DecodeRaw(v *Packet) ([]json.RawMessage, *Binary, error) {
+	if d.data == nil {
+		return nil, nil, nil
+	}
+	defer d.Close()
+	var raw []json.RawMessage
+	if err := json.Unmarshal(d.data, &raw); err != nil {
+		d.invalid = true
+		return nil, nil, err
+	}
+	var binary *Binary
+	if v.Type == BINARY_EVENT || v.Type == BINARY_ACK {
+		var err error
+		binary, err = d.decodeBinary()
+		if err != nil {
+			return nil, nil, err
+		}
+		v.Type -= BINARY_EVENT - EVENT
+	}
+	return raw, binary, nil
+}
+
+// decodeBinary reads the attachments of the packet, a streaming Decoder
+// spools them.
+func (d *Decoder) decodeBinary() (*Binary, error) {
+	ret := &Binary{stream: d.stream}
+	for d.pending > 0 {
+		t, r, err := d.reader.NextReader()
+		if err != nil {
+			return nil, err
+		}
+		d.pending--
+		if t == engineio.MessageText {
+			// the packet is cut short, the frame is likely the next one.
+			r.Close()
+			d.pending = 0
+			return nil, &PacketError{Err: UnexpectedFrameError, Detail: "text frame instead of an attachment"}
+		}
+		var part *spooled
+		if d.stream {
+			part, err = d.spool(&limitedReader{r: r, max: d.limits.MaxAttachmentSize})
+		} else {
+			var b []byte
+			b, err = readLimited(r, d.limits.MaxAttachmentSize)
+			part = inMemory(b)
+		}
+		r.Close()
+		if err != nil {
+			// nobody takes the attachments spooled so far.
+			ret.Close()
+			return nil, err
+		}
+		ret.parts = append(ret.parts, part)
+	}
+	return ret, nil
+}
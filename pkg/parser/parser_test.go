@@ -0,0 +1,294 @@
+package parser
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/weblfe/webss/pkg/engineio"
+)
+
+func textFrames(packet string, attachments ...string) Frames {
+	f := Frames{{Type: engineio.MessageText, Data: []byte(packet)}}
+	for _, a := range attachments {
+		f = append(f, Frame{Type: engineio.MessageBinary, Data: []byte(a)})
+	}
+	return f
+}
+
+// specVectors are the examples of the socket.io protocol, revision 5.
+var specVectors = []struct {
+	name        string
+	packet      string
+	attachments []string
+	want        Packet
+	message     string
+	data        string // arguments or payload as raw JSON
+}{
+	{"connect main namespace", `0`, nil,
+		Packet{Type: CONNECT, Id: -1}, "", ""},
+	{"connect with payload", `0{"token":"123"}`, nil,
+		Packet{Type: CONNECT, Id: -1}, "", `{"token":"123"}`},
+	{"connect custom namespace", `0/admin,`, nil,
+		Packet{Type: CONNECT, NSP: "/admin", Id: -1}, "", ""},
+	{"connect answer", `0/admin,{"sid":"oSO0OpakMV_3jnilAAAA"}`, nil,
+		Packet{Type: CONNECT, NSP: "/admin", Id: -1}, "", `{"sid":"oSO0OpakMV_3jnilAAAA"}`},
+	{"connect namespace without comma", `0/admin`, nil,
+		Packet{Type: CONNECT, NSP: "/admin", Id: -1}, "", ""},
+	{"disconnect", `1/admin,`, nil,
+		Packet{Type: DISCONNECT, NSP: "/admin", Id: -1}, "", ""},
+	{"event", `2["hello",1]`, nil,
+		Packet{Type: EVENT, Id: -1}, "hello", `[1]`},
+	{"event without arguments", `2["hello"]`, nil,
+		Packet{Type: EVENT, Id: -1}, "hello", `[]`},
+	{"event with ack", `2/admin,456["project:delete",123]`, nil,
+		Packet{Type: EVENT, NSP: "/admin", Id: 456}, "project:delete", `[123]`},
+	{"event with ack on main namespace", `212["hello"]`, nil,
+		Packet{Type: EVENT, Id: 12}, "hello", `[]`},
+	{"ack", `3/admin,456[]`, nil,
+		Packet{Type: ACK, NSP: "/admin", Id: 456}, "", `[]`},
+	{"ack on main namespace", `37["ok",{"a":1}]`, nil,
+		Packet{Type: ACK, Id: 7}, "", `["ok",{"a":1}]`},
+	{"connect error", `4/admin,{"message":"Not authorized"}`, nil,
+		Packet{Type: ERROR, NSP: "/admin", Id: -1}, "", `{"message":"Not authorized"}`},
+	{"error string", `4"Not authorized"`, nil,
+		Packet{Type: ERROR, Id: -1}, "", `"Not authorized"`},
+	{"binary event", `51-["hello",{"_placeholder":true,"num":0}]`, []string{"\x01\x02\x03"},
+		Packet{Type: BINARY_EVENT, Id: -1, Attachments: 1}, "hello", `[{"_placeholder":true,"num":0}]`},
+	{"binary ack", `61-/admin,456[{"_placeholder":true,"num":0}]`, []string{"\x03\x02\x01"},
+		Packet{Type: BINARY_ACK, NSP: "/admin", Id: 456, Attachments: 1}, "", `[{"_placeholder":true,"num":0}]`},
+}
+
+func TestDecodeSpecVectors(t *testing.T) {
+	for _, tt := range specVectors {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDecoder(textFrames(tt.packet, tt.attachments...).Reader())
+			defer d.Close()
+			var p Packet
+			if err := d.Decode(&p); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(p, tt.want) {
+				t.Fatalf("packet %+v, want %+v", p, tt.want)
+			}
+			if d.Message() != tt.message {
+				t.Fatalf("message %q, want %q", d.Message(), tt.message)
+			}
+			if data := string(d.data); data != tt.data {
+				t.Fatalf("data %s, want %s", data, tt.data)
+			}
+			if len(tt.attachments) == 0 {
+				return
+			}
+			_, binary, err := d.DecodeRaw(&p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if binary == nil || binary.Len() != len(tt.attachments) {
+				t.Fatalf("binary %v, want %d attachments", binary, len(tt.attachments))
+			}
+			var args []*Attachment
+			json.Unmarshal([]byte(tt.data), &args)
+			if err := binary.Decode(&args); err != nil {
+				t.Fatal(err)
+			}
+			b, _ := ioutil.ReadAll(args[0].Data)
+			if string(b) != tt.attachments[0] {
+				t.Fatalf("attachment %q, want %q", b, tt.attachments[0])
+			}
+		})
+	}
+}
+
+func TestEncodeSpecVectors(t *testing.T) {
+	tests := []struct {
+		packet Packet
+		want   []string
+	}{
+		{Packet{Type: CONNECT, Id: -1}, []string{`0`}},
+		{Packet{Type: CONNECT, NSP: "/admin", Id: -1, Data: map[string]string{"token": "123"}}, []string{`0/admin,{"token":"123"}`}},
+		{Packet{Type: DISCONNECT, NSP: "/admin", Id: -1}, []string{`1/admin`}},
+		{Packet{Type: EVENT, Id: -1, Data: []interface{}{"hello", 1}}, []string{`2["hello",1]`}},
+		{Packet{Type: EVENT, NSP: "/admin", Id: 456, Data: []interface{}{"project:delete", 123}}, []string{`2/admin,456["project:delete",123]`}},
+		{Packet{Type: ACK, NSP: "/admin", Id: 456, Data: []interface{}{}}, []string{`3/admin,456[]`}},
+		{Packet{Type: EVENT, Id: -1, Data: []interface{}{"hello", NewAttachment(strings.NewReader("\x01\x02\x03"))}},
+			[]string{`51-["hello",{"_placeholder":true,"num":0}]`, "\x01\x02\x03"}},
+		{Packet{Type: ACK, NSP: "/admin", Id: 456, Data: []interface{}{NewAttachment(strings.NewReader("\x03\x02\x01"))}},
+			[]string{`61-/admin,456[{"_placeholder":true,"num":0}]`, "\x03\x02\x01"}},
+	}
+	for _, tt := range tests {
+		f, err := Marshal(tt.packet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, frame := range f {
+			got = append(got, string(frame.Data))
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%+v encoded as %q, want %q", tt.packet, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	tests := []struct {
+		packet string
+		want   error
+	}{
+		{``, InvalidTypeError},
+		{`7`, InvalidTypeError},
+		{`a`, InvalidTypeError},
+		{`5["a"]`, InvalidAttachmentsError},
+		{`5-["a"]`, InvalidAttachmentsError},
+		{`51["a"]`, InvalidAttachmentsError},
+		{`599999999999-["a"]`, InvalidAttachmentsError},
+		{`3[]`, InvalidIdError},
+		{`3/chat,`, InvalidIdError},
+		{`3/chat,[]`, InvalidIdError},
+		{`61-[{"_placeholder":true,"num":0}]`, InvalidIdError},
+		{`299999999999["a"]`, InvalidIdError},
+		{`2`, InvalidPayloadError},
+		{`2[]`, InvalidPayloadError},
+		{`2[1]`, InvalidPayloadError},
+		{`2{"a":1}`, InvalidPayloadError},
+		{`2["a"`, InvalidPayloadError},
+		{`0[]`, InvalidPayloadError},
+		{`1{}`, InvalidPayloadError},
+		{`31{}`, InvalidPayloadError},
+		{`4[]`, InvalidPayloadError},
+	}
+	for _, tt := range tests {
+		var p Packet
+		_, err := Unmarshal(textFrames(tt.packet), &p)
+		var pe *PacketError
+		if !errors.As(err, &pe) || !errors.Is(err, tt.want) {
+			t.Errorf("%q: err = %v, want %v", tt.packet, err, tt.want)
+		}
+	}
+
+	var p Packet
+	_, err := Unmarshal(Frames{{Type: engineio.MessageBinary, Data: []byte("2[\"a\"]")}}, &p)
+	if !errors.Is(err, UnexpectedFrameError) {
+		t.Errorf("binary frame: err = %v, want UnexpectedFrameError", err)
+	}
+}
+
+func TestDecodeLimits(t *testing.T) {
+	tests := []struct {
+		limits Limits
+		frames Frames
+	}{
+		{Limits{MaxPacketSize: 8}, textFrames(`2["hello world"]`)},
+		{Limits{MaxAttachments: 1}, textFrames(`52-["a",{"_placeholder":true,"num":0},{"_placeholder":true,"num":1}]`, "x", "y")},
+		{Limits{MaxAttachmentSize: 2}, textFrames(`51-["a",{"_placeholder":true,"num":0}]`, "xyz")},
+		{Limits{MaxDepth: 2}, textFrames(`2["a",[[1]]]`)},
+	}
+	for _, tt := range tests {
+		d := NewDecoder(tt.frames.Reader())
+		d.SetLimits(tt.limits)
+		var p Packet
+		err := d.Decode(&p)
+		if err == nil {
+			// the attachments are read with the payload.
+			var args []interface{}
+			p.Data = &args
+			err = d.DecodeData(&p)
+		}
+		if !errors.Is(err, LimitError) {
+			t.Errorf("%+v: err = %v, want LimitError", tt.limits, err)
+		}
+		d.Close()
+	}
+}
+
+func FuzzDecode(f *testing.F) {
+	for _, tt := range specVectors {
+		f.Add(tt.packet)
+	}
+	f.Add(`3[]`)
+	f.Add(`52-/a,1[{"_placeholder":true,"num":5}]`)
+	f.Fuzz(func(t *testing.T, packet string) {
+		d := NewDecoder(textFrames(packet, "x", "y").Reader())
+		defer d.Close()
+		var p Packet
+		if err := d.Decode(&p); err != nil {
+			var pe *PacketError
+			if !errors.As(err, &pe) {
+				t.Fatalf("%q: error %v is no *PacketError", packet, err)
+			}
+			return
+		}
+		if p.Type > BINARY_ACK || p.Id < -1 || p.Attachments < 0 {
+			t.Fatalf("%q: decoded %+v", packet, p)
+		}
+		if (p.Type == ACK || p.Type == BINARY_ACK) && p.Id < 0 {
+			t.Fatalf("%q: ack without id", packet)
+		}
+		if p.Type != EVENT && p.Type != BINARY_EVENT {
+			return
+		}
+		if p.Type == BINARY_EVENT {
+			return
+		}
+		// an event re-encodes to a packet decoded the same.
+		raw, _, err := d.DecodeRaw(&p)
+		if err != nil {
+			t.Fatalf("%q: %v", packet, err)
+		}
+		args := []interface{}{d.Message()}
+		for _, a := range raw {
+			args = append(args, a)
+		}
+		p.Data = args
+		frames, err := Marshal(p)
+		if err != nil {
+			t.Fatalf("%q: %v", packet, err)
+		}
+		var again Packet
+		message, err := Unmarshal(frames, &again)
+		if err != nil || message != d.Message() || again.NSP != p.NSP || again.Id != p.Id {
+			t.Fatalf("%q: re-encoded as %q, decoded %+v %q, %v", packet, frames[0].Data, again, message, err)
+		}
+	})
+}
+
+func FuzzDecodeData(f *testing.F) {
+	f.Add(`51-["a",{"_placeholder":true,"num":0}]`, "data")
+	f.Add(`52-["a",{"f":{"_placeholder":true,"num":1}},[{"_placeholder":true,"num":0}]]`, "data")
+	f.Add(`2["a",{"_placeholder":true,"num":-1}]`, "")
+	f.Add(`2["a",1,"b",{"c":[null]}]`, "")
+	f.Fuzz(func(t *testing.T, packet string, attachment string) {
+		for _, stream := range []bool{false, true} {
+			d := NewDecoder(textFrames(packet, attachment, attachment).Reader())
+			if stream {
+				d.SetStreaming(2, t.TempDir())
+			}
+			var p Packet
+			if err := d.Decode(&p); err != nil {
+				d.Close()
+				continue
+			}
+			var args []struct {
+				File  *Attachment            `json:"f"`
+				Files []*Attachment          `json:"files"`
+				Map   map[string]*Attachment `json:"m"`
+			}
+			p.Data = &args
+			if err := d.DecodeData(&p); err == nil {
+				for _, a := range args {
+					if a.File != nil && a.File.Data != nil {
+						ioutil.ReadAll(a.File.Data)
+					}
+				}
+			}
+			var any []interface{}
+			p.Data = &any
+			d.DecodeData(&p)
+			d.Close()
+		}
+	})
+}
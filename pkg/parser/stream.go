@@ -0,0 +1,283 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+
+	"github.com/weblfe/webss/pkg/engineio"
+)
+
+// SetStreaming makes DecodeData hand the attachments out as streams of their
+// frames instead of reading them first. The part of an attachment not read
+// before the next frame is needed, or when the Decoder is closed, is spooled:
+// in memory up to threshold bytes, then to a temp file of dir, removed once
+// the attachment is closed. DecodeRaw spools every attachment, Binary.Close
+// releases them.
+func (d *Decoder) SetStreaming(threshold int64, dir string) {
+	d.stream = true
+	d.threshold = threshold
+	d.dir = dir
+}
+
+// attachmentStream is the Data of an attachment received by a streaming
+// Decoder: it reads the frame while it is the current one, then what was spooled of it.
+type attachmentStream struct {
+	d     *Decoder
+	num   int
+	r     io.Reader // the frame, or the spooled remainder, nil until opened
+	frame io.Closer // the frame until it is released
+	spool *spooled  // the spooled remainder, released by Close
+	err   error
+}
+
+func (s *attachmentStream) Read(p []byte) (int, error) {
+	s.d.locker.Lock()
+	defer s.d.locker.Unlock()
+	if s.r == nil && s.err == nil {
+		s.err = s.d.openAttachment(s.num)
+	}
+	if s.err != nil {
+		return 0, s.err
+	}
+	n, err := s.r.Read(p)
+	if s.frame == nil {
+		if err != nil && err != io.EOF {
+			s.err = err
+		}
+		return n, err
+	}
+	switch {
+	case err == io.EOF:
+		// the frame is over, let the transport read the next one.
+		s.d.closeFrame()
+		s.r = bytes.NewReader(nil)
+	case err != nil:
+		s.err = err
+		s.d.fail(err)
+	}
+	return n, err
+}
+
+func (s *attachmentStream) Write([]byte) (int, error) {
+	return 0, ReadOnlyError
+}
+
+// Close drops the rest of the frame, or the spooled remainder. The frame is
+// dropped without being spooled when it was not read yet.
+func (s *attachmentStream) Close() error {
+	s.d.locker.Lock()
+	defer s.d.locker.Unlock()
+	if s.err == AttachmentClosedError {
+		return nil
+	}
+	s.err = AttachmentClosedError
+	if s.frame != nil {
+		s.d.closeFrame()
+	}
+	if s.spool != nil {
+		return s.spool.Close()
+	}
+	return nil
+}
+
+// streamAttachments gives a stream to the attachments without Data found in
+// v, and copies the others into their Data.
+func (d *Decoder) streamAttachments(v interface{}) error {
+	var attachments []*Attachment
+	if err := collectAttachments(reflect.ValueOf(v), &attachments); err != nil {
+		return err
+	}
+	d.locker.Lock()
+	d.streams = make([]*attachmentStream, d.pending)
+	d.next = 0
+	for _, a := range attachments {
+		if a.num >= len(d.streams) || a.num < 0 {
+			d.locker.Unlock()
+			return &PacketError{Err: InvalidAttachmentsError, Detail: fmt.Sprintf("placeholder %d out of range", a.num)}
+		}
+		if d.streams[a.num] != nil {
+			d.locker.Unlock()
+			return &PacketError{Err: InvalidAttachmentsError, Detail: fmt.Sprintf("placeholder %d used twice", a.num)}
+		}
+		d.streams[a.num] = &attachmentStream{d: d, num: a.num}
+	}
+	d.locker.Unlock()
+
+	for _, a := range attachments {
+		s := d.streams[a.num]
+		if a.Data == nil {
+			a.Data = s
+			continue
+		}
+		if _, err := io.Copy(a.Data, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openAttachment reads the frames up to the one of attachment num, the
+// attachments handed out on the way are spooled, the others dropped.
+func (d *Decoder) openAttachment(num int) error {
+	for d.err == nil && d.next <= num {
+		if err := d.release(); err != nil {
+			d.fail(err)
+			break
+		}
+		t, r, err := d.reader.NextReader()
+		if err != nil {
+			d.pending = 0
+			d.fail(err)
+			break
+		}
+		d.pending--
+		s := d.streams[d.next]
+		d.next++
+		if t == engineio.MessageText {
+			r.Close()
+			d.pending = 0
+			d.fail(&PacketError{Err: UnexpectedFrameError, Detail: "text frame instead of an attachment"})
+			break
+		}
+		if s == nil || s.err == AttachmentClosedError {
+			r.Close()
+			continue
+		}
+		s.r = &limitedReader{r: r, max: d.limits.MaxAttachmentSize}
+		s.frame = r
+		d.current = s
+	}
+	return d.err
+}
+
+// release spools the rest of the current frame for its stream.
+func (d *Decoder) release() error {
+	s := d.current
+	if s == nil {
+		return nil
+	}
+	var err error
+	if s.err == nil {
+		if s.spool, err = d.spool(s.r); err == nil {
+			s.r = s.spool
+		}
+		s.err = err
+	}
+	d.closeFrame()
+	return err
+}
+
+func (d *Decoder) closeFrame() {
+	if s := d.current; s != nil {
+		s.frame.Close()
+		s.frame = nil
+		d.current = nil
+	}
+}
+
+// fail keeps the first error met reading the frames, it is returned by Err.
+func (d *Decoder) fail(err error) {
+	if d.err == nil {
+		d.err = err
+	}
+	d.closeFrame()
+}
+
+// closeStreams spools what the streams have not read yet and drops the
+// frames nobody asked for. The streams are closed first when nobody took
+// them, their frames are then dropped too.
+func (d *Decoder) closeStreams(drop bool) {
+	if drop {
+		d.locker.Lock()
+		streams := d.streams
+		d.locker.Unlock()
+		for _, s := range streams {
+			if s != nil {
+				s.Close()
+			}
+		}
+	}
+	d.locker.Lock()
+	defer d.locker.Unlock()
+	if d.streams == nil {
+		return
+	}
+	if len(d.streams) > 0 {
+		d.openAttachment(len(d.streams) - 1)
+	}
+	if err := d.release(); err != nil {
+		d.fail(err)
+	}
+	d.streams = nil
+}
+
+// spooled is an attachment read into memory or into a temp file, which Close
+// closes and removes.
+type spooled struct {
+	*io.SectionReader
+	f       *os.File
+	removed bool // the file was removed while open
+}
+
+func inMemory(b []byte) *spooled {
+	return &spooled{SectionReader: io.NewSectionReader(bytes.NewReader(b), 0, int64(len(b)))}
+}
+
+func (s *spooled) Close() error {
+	if s.f == nil {
+		return nil
+	}
+	err := s.f.Close()
+	if !s.removed {
+		// Windows does not remove the open files.
+		os.Remove(s.f.Name())
+	}
+	s.f = nil
+	return err
+}
+
+// spool reads r into memory, or into a temp file past the threshold.
+func (d *Decoder) spool(r io.Reader) (*spooled, error) {
+	var buf bytes.Buffer
+	_, err := io.CopyN(&buf, r, d.threshold+1)
+	if err == io.EOF {
+		return inMemory(buf.Bytes()), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	f, err := ioutil.TempFile(d.dir, "attachment-")
+	if err != nil {
+		return nil, err
+	}
+	// the file lives as long as it is open, where the system allows it.
+	s := &spooled{f: f, removed: os.Remove(f.Name()) == nil}
+	size, err := io.Copy(f, io.MultiReader(&buf, r))
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	s.SectionReader = io.NewSectionReader(f, 0, size)
+	return s, nil
+}
+
+// limitedReader fails with LimitError once r gives more than max bytes, 0
+// means unlimited.
+type limitedReader struct {
+	r   io.Reader
+	max int64
+	n   int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.n += int64(n)
+	if l.max > 0 && l.n > l.max {
+		return 0, &PacketError{Err: LimitError, Detail: fmt.Sprintf("frame larger than %d bytes", l.max)}
+	}
+	return n, err
+}
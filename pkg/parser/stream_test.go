@@ -0,0 +1,126 @@
+package parser
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// noDir makes the spools past the threshold fail, Err tells a frame was spooled.
+func noDir(t *testing.T) string {
+	return filepath.Join(t.TempDir(), "missing")
+}
+
+func TestStreamClose(t *testing.T) {
+	frames := textFrames(`52-["a",{"_placeholder":true,"num":0},{"_placeholder":true,"num":1}]`, "first", "second")
+	d := NewDecoder(frames.Reader())
+	d.SetStreaming(0, noDir(t))
+	var p Packet
+	if err := d.Decode(&p); err != nil {
+		t.Fatal(err)
+	}
+	var args []*Attachment
+	p.Data = &args
+	if err := d.DecodeData(&p); err != nil {
+		t.Fatal(err)
+	}
+	// the first attachment is given up without being read, nor spooled.
+	if err := args[0].Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := args[0].Data.Read(make([]byte, 1)); err != AttachmentClosedError {
+		t.Fatalf("read after Close = %v, want AttachmentClosedError", err)
+	}
+	b, err := ioutil.ReadAll(args[1].Data)
+	if err != nil || string(b) != "second" {
+		t.Fatalf("second attachment %q, %v", b, err)
+	}
+	d.Close()
+	if err := d.Err(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStreamCloseSpooled(t *testing.T) {
+	frames := textFrames(`51-["a",{"_placeholder":true,"num":0}]`, "spooled to a file")
+	d := NewDecoder(frames.Reader())
+	d.SetStreaming(2, t.TempDir())
+	var p Packet
+	if err := d.Decode(&p); err != nil {
+		t.Fatal(err)
+	}
+	var args []*Attachment
+	p.Data = &args
+	if err := d.DecodeData(&p); err != nil {
+		t.Fatal(err)
+	}
+	d.Close()
+	s := args[0].Data.(*attachmentStream)
+	if s.spool == nil || s.spool.f == nil {
+		t.Fatal("the attachment was not spooled to a file")
+	}
+	f := s.spool.f
+	args[0].Close()
+	if _, err := f.Stat(); err == nil {
+		t.Fatal("the spool file is still open")
+	}
+}
+
+func TestStreamsClosedOnFailedDecode(t *testing.T) {
+	frames := textFrames(`52-["a",{"_placeholder":true,"num":0},{"_placeholder":true,"num":0}]`, "first", "second")
+	d := NewDecoder(frames.Reader())
+	d.SetStreaming(0, noDir(t))
+	var p Packet
+	if err := d.Decode(&p); err != nil {
+		t.Fatal(err)
+	}
+	var args []*Attachment
+	p.Data = &args
+	if err := d.DecodeData(&p); !isPacketError(err, InvalidAttachmentsError) {
+		t.Fatalf("err = %v, want InvalidAttachmentsError", err)
+	}
+	// nobody took the streams, their frames are dropped without being spooled.
+	if err := d.Err(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBinaryClose(t *testing.T) {
+	frames := textFrames(`51-["a",{"_placeholder":true,"num":0}]`, "spooled to a file")
+	d := NewDecoder(frames.Reader())
+	d.SetStreaming(2, t.TempDir())
+	var p Packet
+	if err := d.Decode(&p); err != nil {
+		t.Fatal(err)
+	}
+	_, binary, err := d.DecodeRaw(&p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := binary.parts[0].f
+	if f == nil {
+		t.Fatal("the attachment was not spooled to a file")
+	}
+	if err := binary.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Stat(); err == nil {
+		t.Fatal("the spool file is still open")
+	}
+}
+
+func TestSpoolRemovedOnClose(t *testing.T) {
+	// where the open files cannot be removed, Close removes the spool.
+	f, err := ioutil.TempFile(t.TempDir(), "attachment-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &spooled{f: f}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(f.Name()); !os.IsNotExist(err) {
+		t.Fatalf("spool file left: %v", err)
+	}
+}